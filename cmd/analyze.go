@@ -0,0 +1,125 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "text/tabwriter"
+    "time"
+
+    "github.com/chrisdamba/simstreamdata/pkg/config"
+    "github.com/chrisdamba/simstreamdata/pkg/models"
+    "github.com/spf13/cobra"
+)
+
+// analyzeTop is how many states or pages each table of the analysis lists.
+var analyzeTop int
+
+var analyzeCmd = &cobra.Command{
+    Use:   "analyze",
+    Short: "Predicts session behaviour from the configured state machine",
+    Long: `Analyze solves the session state machine as an absorbing Markov chain and prints, for sessions starting with each auth and level and for all sessions together, the expected session length in page views and time, the pages sessions end on, and the long-run share of page views on each page.`,
+    Args:  cobra.NoArgs,
+    Run: func(cmd *cobra.Command, args []string) {
+        cfg, err := config.LoadConfig(cfgFile, profiles...)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+            os.Exit(1)
+        }
+        stateMap, err := models.InitializeStatesWithAuthLevel(cfg)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Invalid state machine: %v\n", err)
+            os.Exit(1)
+        }
+
+        warnHistoryTransitions(stateMap, "the analysis")
+
+        var analyses []*models.ChainAnalysis
+        var weights []float64
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        for _, auth := range cfg.AuthLevels {
+            shares := cfg.LevelShares(auth.Name)
+            for _, level := range cfg.Levels {
+                start := stateMap.StartDistribution(auth.Name, level.Name)
+                if start == nil {
+                    continue
+                }
+                analysis, err := stateMap.Analyze(start, cfg)
+                if err != nil {
+                    fmt.Fprintf(os.Stderr, "Sessions starting %s, %s: %v\n", auth.Name, level.Name, err)
+                    os.Exit(1)
+                }
+                analyses = append(analyses, analysis)
+                weights = append(weights, float64(auth.Weight)*shares[level.Name])
+                fmt.Fprintf(w, "Sessions starting %s, %s\n", auth.Name, level.Name)
+                printAnalysis(w, analysis)
+            }
+        }
+        overall := models.MixAnalyses(analyses, weights)
+        fmt.Fprintln(w, "All sessions, weighted by auth-levels, subscription-chances and levels")
+        printAnalysis(w, overall)
+        fmt.Fprintln(w, "  Share of page views (stationary distribution):")
+        pages := overall.PageDistribution()
+        for _, page := range topKeys(pages, analyzeTop, func(a, b string) bool { return a < b }) {
+            fmt.Fprintf(w, "    %s\t%.2f%%\n", page, 100*pages[page])
+        }
+        w.Flush()
+    },
+}
+
+// printAnalysis prints the expected session length and the states sessions end on.
+func printAnalysis(w *tabwriter.Writer, analysis *models.ChainAnalysis) {
+    fmt.Fprintf(w, "  Expected length:\t%.2f page views, %s excluding playback\n", analysis.ExpectedEvents, analysis.ExpectedTime.Round(time.Second))
+    fmt.Fprintln(w, "  Ends on (absorption probabilities):")
+    for _, state := range topKeys(analysis.Absorption, analyzeTop, stateLess) {
+        fmt.Fprintf(w, "    %s %s %d (%s, %s)\t%.2f%%\n", state.Method, state.Page, state.StatusCode, state.AuthStatus, state.UserLevel, 100*analysis.Absorption[state])
+    }
+    fmt.Fprintln(w)
+}
+
+// warnHistoryTransitions lists on stderr the history transitions the first-order chain of
+// the analysis and the graph leaves out, if the config has any.
+func warnHistoryTransitions(stateMap *models.AuthLevelStateMap, what string) {
+    histories := stateMap.HistoryTransitions()
+    if len(histories) == 0 {
+        return
+    }
+    fmt.Fprintf(os.Stderr, "Warning: %s follows first-order transitions only and leaves out these transitions that depend on the pages before:\n", what)
+    for _, history := range histories {
+        fmt.Fprintf(os.Stderr, "  %s\n", history)
+    }
+}
+
+func stateLess(a, b *models.State) bool {
+    if a.Page != b.Page {
+        return a.Page < b.Page
+    }
+    if a.AuthStatus != b.AuthStatus {
+        return a.AuthStatus < b.AuthStatus
+    }
+    return a.UserLevel < b.UserLevel
+}
+
+// topKeys returns up to n keys of weights from the heaviest to the lightest, all of them
+// when n is not positive.
+func topKeys[K comparable](weights map[K]float64, n int, less func(a, b K) bool) []K {
+    keys := make([]K, 0, len(weights))
+    for k := range weights {
+        keys = append(keys, k)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        if weights[keys[i]] != weights[keys[j]] {
+            return weights[keys[i]] > weights[keys[j]]
+        }
+        return less(keys[i], keys[j])
+    })
+    if n > 0 && len(keys) > n {
+        keys = keys[:n]
+    }
+    return keys
+}
+
+func init() {
+    analyzeCmd.Flags().IntVar(&analyzeTop, "top", 10, "number of states and pages to list, all when 0")
+    rootCmd.AddCommand(analyzeCmd)
+}
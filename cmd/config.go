@@ -0,0 +1,58 @@
+package cmd
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "text/tabwriter"
+
+    "github.com/chrisdamba/simstreamdata/pkg/config"
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+)
+
+var configPrintJSON bool
+
+var configCmd = &cobra.Command{
+    Use:   "config",
+    Short: "Inspects the effective configuration",
+}
+
+var configPrintCmd = &cobra.Command{
+    Use:   "print",
+    Short: "Prints the merged config and where each value came from",
+    Long: `Print merges the config file, the profiles given with --profile, the SIMSTREAM_ environment variables and the simulation's flags, such as --n-users or --end-time, the way the simulation does, and prints every value with its JSON path and the layer that set it: the config file, a profile, an environment variable, a flag or a default.`,
+    Args:  cobra.NoArgs,
+    Run: func(cmd *cobra.Command, args []string) {
+        layers, err := config.LoadLayers(cfgFile, profiles)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+            os.Exit(1)
+        }
+        layers.ApplyViper(viper.GetViper(), func(key string) bool {
+            flag := cmd.Flags().Lookup(key)
+            return flag != nil && flag.Changed
+        })
+        if configPrintJSON {
+            data, err := json.MarshalIndent(layers.Values, "", "  ")
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Error encoding config: %v\n", err)
+                os.Exit(1)
+            }
+            fmt.Println(string(data))
+            return
+        }
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        for _, setting := range layers.Settings() {
+            value, _ := json.Marshal(setting.Value)
+            fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Path, value, setting.Source)
+        }
+        w.Flush()
+    },
+}
+
+func init() {
+    configPrintCmd.Flags().BoolVar(&configPrintJSON, "json", false, "print the merged config as JSON, without sources")
+    configCmd.AddCommand(configPrintCmd)
+    rootCmd.AddCommand(configCmd)
+}
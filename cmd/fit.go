@@ -0,0 +1,101 @@
+package cmd
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+
+    "github.com/chrisdamba/simstreamdata/pkg/config"
+    "github.com/chrisdamba/simstreamdata/pkg/fit"
+    "github.com/spf13/cobra"
+)
+
+var (
+    fitBase   string
+    fitOutput string
+)
+
+var fitCmd = &cobra.Command{
+    Use:   "fit [events.ndjson ...]",
+    Short: "Estimates a config from clickstream logs",
+    Long: `Fit reads page view events as NDJSON, from the given files or standard input, and estimates the transition probabilities between pages, the new-session page weights, alpha (the gap between page views in a session) and beta (the gap between sessions). It writes a config the simulator can load: the base config with the fitted settings replaced, or a config of the fitted settings alone.`,
+    Run: func(cmd *cobra.Command, args []string) {
+        base := make(map[string]interface{})
+        if fitBase != "" {
+            data, err := os.ReadFile(fitBase)
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Error reading base config: %v\n", err)
+                os.Exit(1)
+            }
+            if err := json.Unmarshal(data, &base); err != nil {
+                fmt.Fprintf(os.Stderr, "Error parsing base config %s: %v\n", fitBase, err)
+                os.Exit(1)
+            }
+        }
+        sessionGap, _ := base["session-gap"].(float64)
+
+        var input io.Reader = os.Stdin
+        if len(args) > 0 && args[0] != "-" {
+            readers := make([]io.Reader, 0, len(args))
+            for _, path := range args {
+                file, err := os.Open(path)
+                if err != nil {
+                    fmt.Fprintf(os.Stderr, "Error opening events: %v\n", err)
+                    os.Exit(1)
+                }
+                readers = append(readers, closeOnEOF{file})
+            }
+            input = io.MultiReader(readers...)
+        }
+        result, err := fit.Fit(input, sessionGap)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error fitting events: %v\n", err)
+            os.Exit(1)
+        }
+        fmt.Fprintf(os.Stderr, "Fitted %d events in %d sessions of %d users: %d start pages, %d transitions, alpha %.1fs, beta %.0fs\n",
+            result.Events, result.Sessions, result.Users, len(result.NewSessionPages), len(result.Transitions), result.Alpha, result.Beta)
+
+        result.Apply(base)
+        data, err := json.MarshalIndent(base, "", "  ")
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error encoding config: %v\n", err)
+            os.Exit(1)
+        }
+        data = append(data, '\n')
+        if fitOutput == "" {
+            os.Stdout.Write(data)
+            return
+        }
+        if err := os.WriteFile(fitOutput, data, 0644); err != nil {
+            fmt.Fprintf(os.Stderr, "Error writing config: %v\n", err)
+            os.Exit(1)
+        }
+        // Sessions the log does not show, such as paid users starting logged out, can leave
+        // the fitted config incomplete; report that rather than failing the fit.
+        if cfg, err := config.LoadConfig(fitOutput); err != nil {
+            fmt.Fprintf(os.Stderr, "Error loading fitted config: %v\n", err)
+        } else if err := cfg.Validate(); err != nil {
+            reportInvalidConfig(err)
+        }
+    },
+}
+
+// closeOnEOF closes a file of events once it has been read to the end.
+type closeOnEOF struct {
+    *os.File
+}
+
+func (r closeOnEOF) Read(p []byte) (int, error) {
+    n, err := r.File.Read(p)
+    if err == io.EOF {
+        r.File.Close()
+    }
+    return n, err
+}
+
+func init() {
+    fitCmd.Flags().StringVar(&fitBase, "base", "", "config to write the fitted settings into, keeping its other settings")
+    fitCmd.Flags().StringVarP(&fitOutput, "output", "o", "", "file to write the config to (default is stdout)")
+    rootCmd.AddCommand(fitCmd)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+    "fmt"
+    "io"
+    "os"
+
+    "github.com/chrisdamba/simstreamdata/pkg/config"
+    "github.com/chrisdamba/simstreamdata/pkg/models"
+    "github.com/spf13/cobra"
+)
+
+var (
+    graphFormat string
+    graphOutput string
+)
+
+var graphCmd = &cobra.Command{
+    Use:   "graph",
+    Short: "Renders the page transition graph as Graphviz DOT or Mermaid",
+    Long: `Graph builds the session state machine from the config file and renders it for review: states are grouped by auth and level, edges are labelled with their probabilities, dead-end states are highlighted and the probability of a session ending on each state is drawn as an edge to "session end".`,
+    Args:  cobra.NoArgs,
+    Run: func(cmd *cobra.Command, args []string) {
+        cfg, err := config.LoadConfig(cfgFile, profiles...)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+            os.Exit(1)
+        }
+        stateMap, err := models.InitializeStatesWithAuthLevel(cfg)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Invalid state machine: %v\n", err)
+            os.Exit(1)
+        }
+        warnHistoryTransitions(stateMap, "the graph")
+
+        var write func(io.Writer) error
+        switch graphFormat {
+        case "dot":
+            write = stateMap.WriteDOT
+        case "mermaid":
+            write = stateMap.WriteMermaid
+        default:
+            fmt.Fprintf(os.Stderr, "Unknown graph format %q, want dot or mermaid\n", graphFormat)
+            os.Exit(1)
+        }
+        out := io.Writer(os.Stdout)
+        if graphOutput != "" {
+            file, err := os.Create(graphOutput)
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", graphOutput, err)
+                os.Exit(1)
+            }
+            defer file.Close()
+            out = file
+        }
+        if err := write(out); err != nil {
+            fmt.Fprintf(os.Stderr, "Error writing graph: %v\n", err)
+            os.Exit(1)
+        }
+    },
+}
+
+func init() {
+    graphCmd.Flags().StringVar(&graphFormat, "format", "dot", "output format, dot or mermaid")
+    graphCmd.Flags().StringVarP(&graphOutput, "output", "o", "", "file to write the graph to (default is stdout)")
+    rootCmd.AddCommand(graphCmd)
+}
@@ -8,13 +8,17 @@ import (
 
 	// "time"
 
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
 	"github.com/chrisdamba/simstreamdata/pkg/config"
     "github.com/chrisdamba/simstreamdata/pkg/simulator"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+    cfgFile  string
+    profiles []string
+)
 
 var rootCmd = &cobra.Command{
     Use:   "simstreamdata",
@@ -24,15 +28,26 @@ var rootCmd = &cobra.Command{
         now := time.Now().Format(time.RFC3339)
         viper.SetDefault("start-time", now)  // This sets it if not already set via config or flags
 
-        cfg, err := config.LoadConfig(cfgFile)
+        cfg, err := config.LoadConfig(cfgFile, profiles...)
         if err != nil {
             fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
             os.Exit(1)
         }
+        if err := cfg.Validate(); err != nil {
+            reportInvalidConfig(err)
+            os.Exit(1)
+        }
         
-        err = cfg.InitializeMovies("data/imdb_movie_dataset")
+        var videos catalog.Catalog
+        videos, err = catalog.Open(cfg.Catalog, cfg.StartTime)
         if err != nil {
-            fmt.Fprintf(os.Stderr, "Error loading movies data: %v", err)
+            fmt.Fprintf(os.Stderr, "Error loading movies data: %v\n", err)
+            videos = catalog.NewMemory(nil)
+        }
+        if cfg.Audio.CatalogPath != "" {
+            if err := cfg.InitializeSongs(cfg.Audio.CatalogPath); err != nil {
+                fmt.Fprintf(os.Stderr, "Error loading songs data: %v\n", err)
+            }
         }
         /*
         fmt.Println("Simulation started with the following configuration:")
@@ -43,14 +58,18 @@ var rootCmd = &cobra.Command{
             fmt.Printf("%s: %v\n", t.Field(i).Name, field.Interface())
         }
         */
-        sim := simulator.NewSimulator(cfg)
+        sim, err := simulator.NewSimulator(cfg, videos)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error setting up simulation: %v\n", err)
+            os.Exit(1)
+        }
         sim.RunSimulation()
     },
 }
 
 func init() {
-    cobra.OnInitialize(initConfig)
-    rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.simstreamdata.yaml)")
+    rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is configs/config.json)")
+    rootCmd.PersistentFlags().StringSliceVar(&profiles, "profile", nil, "profiles to lay over the config, in order, e.g. black-friday for configs/profiles/black-friday.json (default is $SIMSTREAM_PROFILE)")
     // rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
     // rootCmd.Flags().Int("nusers", 1000, "initial number of users")
     // rootCmd.Flags().Float64("growth-rate", 0.01, "annual user growth rate (as a fraction, e.g., 1% => 0.01)")
@@ -78,29 +97,8 @@ func init() {
     rootCmd.Flags().Bool("continuous", false, "run simulation in real-time") 
 
 	viper.BindPFlags(rootCmd.Flags())
-}
-
-func initConfig() {
-    if cfgFile != "" {
-        // Use config file from the flag.
-        viper.SetConfigFile(cfgFile)
-    } else {
-        // Find home directory.
-        home, err := os.UserHomeDir()
-        cobra.CheckErr(err)
-
-        // Search config in home directory with name ".cobra" (without extension).
-        viper.AddConfigPath(home)
-        viper.SetConfigType("yaml")
-        viper.SetConfigName(".simstreamdata")
-    }
-
-    viper.AutomaticEnv() // read in environment variables that match
-
-    // If a config file is found, read it in.
-    if err := viper.ReadInConfig(); err == nil {
-        fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
-    }
+	// config print takes the same flags, to show what they override
+	configPrintCmd.Flags().AddFlagSet(rootCmd.Flags())
 }
 
 // Execute executes the root command.
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+    "errors"
+    "fmt"
+    "os"
+
+    "github.com/chrisdamba/simstreamdata/pkg/config"
+    "github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+    Use:   "validate",
+    Short: "Checks a config file for problems without running the simulation",
+    Long: `Validate loads the config file and reports every problem that would make the simulation fail or behave unexpectedly, each with the JSON path of the offending value.`,
+    Args:  cobra.NoArgs,
+    Run: func(cmd *cobra.Command, args []string) {
+        cfg, err := config.LoadConfig(cfgFile, profiles...)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+            os.Exit(1)
+        }
+        if err := cfg.Validate(); err != nil {
+            reportInvalidConfig(err)
+            os.Exit(1)
+        }
+        fmt.Println("Config is valid.")
+    },
+}
+
+// reportInvalidConfig prints the problems Config.Validate found, one per line.
+func reportInvalidConfig(err error) {
+    var errs config.ValidationErrors
+    if !errors.As(err, &errs) {
+        fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+        return
+    }
+    fmt.Fprintf(os.Stderr, "Invalid config, %d problem(s):\n", len(errs))
+    for _, e := range errs {
+        fmt.Fprintf(os.Stderr, "  %s\n", e)
+    }
+}
+
+func init() {
+    rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,97 @@
+// Package catalog holds the content users watch: a common Item type for every title and a
+// Catalog interface the simulation picks content from, whatever source it was loaded from.
+package catalog
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// Item is a title in the catalog: a movie, an episode of a series or any other video.
+type Item struct {
+	ID      string        `json:"id"`
+	Title   string        `json:"title"`
+	Type    string        `json:"type,omitempty"` // IMDb title type such as movie, tvMovie or tvEpisode
+	Genres  []string      `json:"genres"`
+	Runtime time.Duration `json:"-"`
+	Year    int           `json:"year,omitempty"`
+	Rating  float64       `json:"rating,omitempty"`
+	Votes   int           `json:"votes,omitempty"`
+	Star    string        `json:"star,omitempty"`
+
+	Released    time.Time `json:"released,omitempty"`    // release date; zero when unknown, which makes the item always available
+	LaunchBoost float64   `json:"launchBoost,omitempty"` // launch boost of the item, the model's when zero
+	Licenses    []Window  `json:"-"`                     // where and when the item can be watched, everywhere and always when empty
+}
+
+// Query describes the items a pick may return.
+type Query struct {
+	Genre  string    // genre of the item, any genre when empty
+	At     time.Time // time of the pick, which decides launch boosts and licence windows
+	Region string    // region of the viewer; items not licensed there are skipped
+}
+
+// Popularity weighs an item for selection by its audience size and reception:
+// the log of its vote count scaled by its rating. Unrated items count as average.
+func (i *Item) Popularity() float64 {
+	rating := i.Rating
+	if rating <= 0 {
+		rating = 5
+	}
+	return (1 + math.Log1p(float64(i.Votes))) * rating / 10
+}
+
+// Catalog is a read-only collection of items that sessions pick content from.
+// Implementations are safe for concurrent use.
+type Catalog interface {
+	// Get returns the item with the given ID.
+	Get(id string) (*Item, bool)
+	// Genres returns the genres that have at least one item, sorted by name.
+	Genres() []string
+	// Sample returns an item of the genre, or of the whole catalog when genre is empty,
+	// picked uniformly whatever its release date. It returns nil when there is nothing to pick.
+	Sample(rng *rand.Rand, genre string) *Item
+	// SamplePopular picks an item matching the query by its weight at the query's time: its
+	// popularity, shaped by the catalog's popularity model, and boosted around its release.
+	// Items released later or not licensed in the query's region then are never picked.
+	SamplePopular(rng *rand.Rand, q Query) *Item
+	// Each calls fn for every item until fn returns false.
+	Each(fn func(*Item) bool)
+	// Len returns the number of items.
+	Len() int
+}
+
+// Open loads the catalog described by the configuration for a simulation starting at start,
+// adding the configured premieres to the loaded titles.
+func Open(cfg config.CatalogConfig, start time.Time) (Catalog, error) {
+	opts := []Option{
+		WithPopularity(PopularityFromConfig(cfg.Popularity, start)),
+		WithItems(premiereItems(cfg.Premieres, start)),
+		WithLicenses(licensesFromConfig(cfg.Licenses, start)),
+	}
+	switch strings.ToLower(cfg.Source) {
+	case "", "csv":
+		path := cfg.Path
+		if path == "" {
+			path = config.DefaultMovieCatalogPath
+		}
+		return LoadCSV(path, opts...)
+	case "imdb":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("catalog source imdb needs a path to title.basics.tsv.gz")
+		}
+		return LoadIMDb(cfg.Path, IMDbFilter{TitleTypes: cfg.TitleTypes, IncludeAdult: cfg.IncludeAdult}, opts...)
+	case "jsonl":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("catalog source jsonl needs a path")
+		}
+		return LoadJSONL(cfg.Path, opts...)
+	default:
+		return nil, fmt.Errorf("unknown catalog source %q", cfg.Source)
+	}
+}
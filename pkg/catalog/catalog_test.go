@@ -0,0 +1,217 @@
+package catalog
+
+import (
+	"compress/gzip"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func TestMemoryLookupAndSampling(t *testing.T) {
+	hit := &Item{ID: "hit", Genres: []string{"Drama"}, Votes: 500000, Rating: 8.5}
+	obscure := &Item{ID: "obscure", Genres: []string{"Drama", "Comedy"}}
+	m := NewMemory([]*Item{hit, obscure, {ID: "hit", Title: "duplicate"}})
+
+	if m.Len() != 2 {
+		t.Fatalf("catalog holds %d items, want 2 after dropping the duplicate ID", m.Len())
+	}
+	if item, ok := m.Get("hit"); !ok || item != hit {
+		t.Errorf("Get(hit) = %v, %v", item, ok)
+	}
+	if genres := m.Genres(); len(genres) != 2 || genres[0] != "Comedy" || genres[1] != "Drama" {
+		t.Errorf("Genres() = %v, want [Comedy Drama]", genres)
+	}
+	if m.Sample(rand.New(rand.NewSource(1)), "Horror") != nil {
+		t.Error("sampled an item from a genre without items")
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	const draws = 100000
+	hits := 0
+	for i := 0; i < draws; i++ {
+		if m.SamplePopular(rng, Query{Genre: "Drama", At: time.Now()}) == hit {
+			hits++
+		}
+	}
+	want := hit.Popularity() / (hit.Popularity() + obscure.Popularity())
+	if got := float64(hits) / draws; math.Abs(got-want) > 0.01 {
+		t.Errorf("popular item picked %.3f of the time, want %.3f", got, want)
+	}
+}
+
+const basicsSample = "tconst\ttitleType\tprimaryTitle\toriginalTitle\tisAdult\tstartYear\tendYear\truntimeMinutes\tgenres\n" +
+	"tt0000001\tmovie\tFirst\tFirst\t0\t1994\t\\N\t142\tDrama,Crime\n" +
+	"tt0000002\tmovie\tNo Runtime\tNo Runtime\t0\t\\N\t\\N\t\\N\t\\N\n" +
+	"tt0000003\ttvSeries\tA Series\tA Series\t0\t2008\t2013\t47\tDrama\n" +
+	"tt0000004\tmovie\tAdult\tAdult\t1\t2001\t\\N\t90\tDrama\n" +
+	"tt0000005\tmovie\ttruncated\n"
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if filepath.Ext(name) == ".gz" {
+		gz := gzip.NewWriter(file)
+		defer gz.Close()
+		_, err = gz.Write([]byte(content))
+	} else {
+		_, err = file.WriteString(content)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadIMDbFiltersTitlesAndHandlesNulls(t *testing.T) {
+	m, err := LoadIMDb(writeFile(t, "title.basics.tsv.gz", basicsSample), IMDbFilter{TitleTypes: []string{"movie"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != 2 {
+		t.Fatalf("loaded %d titles, want the 2 well-formed non-adult movies", m.Len())
+	}
+	first, _ := m.Get("tt0000001")
+	if first == nil || first.Year != 1994 || first.Runtime != 142*time.Minute {
+		t.Errorf("tt0000001 loaded as %+v", first)
+	}
+	missing, _ := m.Get("tt0000002")
+	if missing == nil || missing.Year != 0 || len(missing.Genres) != 0 || missing.Runtime <= 0 {
+		t.Errorf("\\N values should be empty with a fallback runtime, got %+v", missing)
+	}
+	if drama := m.Sample(rand.New(rand.NewSource(1)), "Drama"); drama == nil || drama.ID != "tt0000001" {
+		t.Errorf("Drama should hold only tt0000001, sampled %+v", drama)
+	}
+}
+
+func TestOpenJSONL(t *testing.T) {
+	path := writeFile(t, "catalog.jsonl",
+		`{"id": "a", "title": "A", "genres": ["Drama"], "runtimeMinutes": 95, "rating": 7.1, "votes": 1200}`+"\n\n"+
+			`{"id": "b", "title": "B", "genres": ["Comedy"]}`+"\n")
+	c, err := Open(config.CatalogConfig{Source: "jsonl", Path: path}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 2 {
+		t.Fatalf("loaded %d items, want 2", c.Len())
+	}
+	a, _ := c.Get("a")
+	if a == nil || a.Runtime != 95*time.Minute || a.Votes != 1200 {
+		t.Errorf("item a loaded as %+v", a)
+	}
+	if _, err := Open(config.CatalogConfig{Source: "jsonl", Path: writeFile(t, "bad.jsonl", `{"title": "no id"}`)}, time.Now()); err == nil {
+		t.Error("an item without an id should fail to load")
+	}
+}
+
+func TestLoadCSVReportsAMissingHeader(t *testing.T) {
+	if _, err := LoadCSV(writeFile(t, "empty.csv", "")); err == nil || !strings.Contains(err.Error(), "header") {
+		t.Errorf("err = %v, want the missing header reported", err)
+	}
+}
+
+func TestPopularityZipfAndLaunchSpike(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 0, 0, 0, 0, time.UTC)
+	first := &Item{ID: "first", Genres: []string{"Drama"}, Votes: 900000, Rating: 9}
+	second := &Item{ID: "second", Genres: []string{"Drama"}, Votes: 500000, Rating: 8}
+	hits := premiereItems([]config.Premiere{{ID: "hit", Genres: []string{"Drama"}, Day: 2, Votes: 100, Boost: 30}}, start)
+	m := NewMemory([]*Item{first, second}, WithItems(hits), WithPopularity(Popularity{
+		ZipfExponent:   1,
+		LaunchHalfLife: 24 * time.Hour,
+		Since:          start,
+	}))
+
+	share := func(at time.Time, id string) float64 {
+		rng := rand.New(rand.NewSource(1))
+		const draws = 50000
+		n := 0
+		for i := 0; i < draws; i++ {
+			if m.SamplePopular(rng, Query{Genre: "Drama", At: at}).ID == id {
+				n++
+			}
+		}
+		return float64(n) / draws
+	}
+
+	// before the premiere the ranks 1 and 2 share the genre 1 : 1/2
+	if got := share(start, "first"); math.Abs(got-2.0/3) > 0.01 {
+		t.Errorf("top title picked %.3f of the time, want 0.667", got)
+	}
+	if got := share(start.Add(24*time.Hour), "hit"); got != 0 {
+		t.Errorf("unreleased premiere picked %.3f of the time", got)
+	}
+	// on release the third-ranked hit weighs (1+30)/3 against 1 and 1/2
+	launch := share(start.Add(48*time.Hour), "hit")
+	if want := (31.0 / 3) / (31.0/3 + 1.5); math.Abs(launch-want) > 0.01 {
+		t.Errorf("hit picked %.3f of the time on release, want %.3f", launch, want)
+	}
+	// eighteen half-lives later the hit is back to its rank's share
+	if later, want := share(start.Add(20*24*time.Hour), "hit"), (1.0/3)/(1.0/3+1.5); math.Abs(later-want) > 0.01 {
+		t.Errorf("hit picked %.3f of the time after its launch, want %.3f", later, want)
+	}
+}
+
+func TestLicensesLimitAvailability(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 0, 0, 0, 0, time.UTC)
+	day := func(n float64) *float64 { return &n }
+	m := NewMemory([]*Item{
+		{ID: "global", Genres: []string{"Drama"}},
+		{ID: "us-only", Genres: []string{"Drama"}, Votes: 1000000, Rating: 9},
+		{ID: "war", Genres: []string{"War"}},
+	}, WithLicenses(licensesFromConfig([]config.License{
+		{Titles: []string{"us-only"}, Regions: []string{"US"}, UntilDay: day(3)},
+		{Titles: []string{"us-only"}, Regions: []string{"US"}, FromDay: day(3), UntilDay: day(5)},
+		{Genres: []string{"War"}, Regions: []string{"GB"}},
+	}, start)))
+
+	usOnly, _ := m.Get("us-only")
+	if !usOnly.AvailableIn("US", start) || usOnly.AvailableIn("GB", start) {
+		t.Error("us-only should be available in the US and nowhere else")
+	}
+	if until := usOnly.AvailableUntil("US", start); !until.Equal(start.AddDate(0, 0, 5)) {
+		t.Errorf("us-only available in the US until %v, want the end of the second window", until)
+	}
+	war, _ := m.Get("war")
+	if !war.AvailableUntil("GB", start).IsZero() {
+		t.Error("a licence without an end should keep the title available")
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		if item := m.SamplePopular(rng, Query{Genre: "Drama", At: start, Region: "GB"}); item == nil || item.ID != "global" {
+			t.Fatalf("picked %v for a viewer in GB", item)
+		}
+		if item := m.SamplePopular(rng, Query{Genre: "Drama", At: start.AddDate(0, 0, 6), Region: "US"}); item == nil || item.ID != "global" {
+			t.Fatalf("picked %v after its licence ended", item)
+		}
+	}
+	if item := m.SamplePopular(rng, Query{Genre: "War", At: start, Region: "US"}); item != nil {
+		t.Errorf("picked %v outside its licensed regions", item)
+	}
+}
+
+func TestNewMemoryLeavesTheItemsAlone(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 0, 0, 0, 0, time.UTC)
+	items := []*Item{{ID: "war", Genres: []string{"War"}}}
+	licenses := WithLicenses(licensesFromConfig([]config.License{{Genres: []string{"War"}, Regions: []string{"GB"}}}, start))
+
+	for i := 0; i < 2; i++ {
+		war, _ := NewMemory(items, licenses).Get("war")
+		if len(war.Licenses) != 1 {
+			t.Errorf("catalog %d: %d licence windows, want 1", i+1, len(war.Licenses))
+		}
+	}
+	if len(items[0].Licenses) != 0 {
+		t.Errorf("the caller's item has %d licence windows, want none", len(items[0].Licenses))
+	}
+}
@@ -0,0 +1,124 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns of the movie CSV files: movie_id, movie_name, year, certificate, runtime, genre,
+// rating, description, director, director_id, star, star_id, votes, gross.
+const (
+	csvID      = 0
+	csvTitle   = 1
+	csvYear    = 2
+	csvRuntime = 4
+	csvGenre   = 5
+	csvRating  = 6
+	csvStar    = 10
+	csvVotes   = 12
+)
+
+// LoadCSV loads the movie CSV file at path, or every CSV file under it when it is a directory.
+func LoadCSV(path string, opts ...Option) (*Memory, error) {
+	var items []*Item
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".csv") {
+			loaded, err := readCSV(path)
+			if err != nil {
+				log.Printf("Failed to load movies: %v", err)
+				return err
+			}
+			items = append(items, loaded...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewMemory(items, opts...), nil
+}
+
+// readCSV reads the movies of a CSV file with a header row.
+func readCSV(filePath string) ([]*Item, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	if _, err := reader.Read(); err != nil {
+		return nil, fmt.Errorf("error reading the header of %s: %w", filePath, err)
+	}
+
+	var items []*Item
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) <= csvVotes {
+			log.Printf("Skipping movie with %d columns", len(record))
+			continue
+		}
+
+		runtime, err := parseRuntime(record[csvRuntime])
+		if err != nil {
+			log.Printf("Skipping movie due to invalid runtime: %v", err)
+			continue
+		}
+
+		year, _ := strconv.Atoi(record[csvYear])
+		rating, _ := strconv.ParseFloat(record[csvRating], 64)
+		votes, _ := strconv.ParseFloat(strings.ReplaceAll(record[csvVotes], ",", ""), 64)
+
+		items = append(items, &Item{
+			Released: releaseDate(year, record[csvID]),
+			ID:       record[csvID],
+			Title:    record[csvTitle],
+			Type:     "movie",
+			Runtime:  runtime,
+			Genres:   strings.Split(record[csvGenre], ", "),
+			Star:     record[csvStar],
+			Year:     year,
+			Rating:   rating,
+			Votes:    int(votes),
+		})
+	}
+	return items, nil
+}
+
+// parseRuntime converts a runtime string "180 min" to time.Duration. Movies without a
+// runtime get a random one between one and three hours.
+func parseRuntime(s string) (time.Duration, error) {
+	if len(s) == 0 {
+		randomMinutes := rand.Intn(121) + 60
+		return time.Duration(randomMinutes) * time.Minute, nil
+	}
+	parts := strings.Fields(s)
+	if len(parts) != 2 || parts[1] != "min" {
+		return 0, errors.New("invalid runtime format")
+	}
+	numberPart := strings.Replace(parts[0], ",", "", -1)
+	minutes, err := strconv.Atoi(numberPart)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
@@ -0,0 +1,123 @@
+package catalog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imdbNull is how IMDb datasets mark a missing value.
+const imdbNull = `\N`
+
+// imdbBasicsColumns is the number of columns of a title.basics row.
+const imdbBasicsColumns = 9
+
+// IMDbFilter selects the titles of an IMDb dataset that go into the catalog.
+type IMDbFilter struct {
+	TitleTypes   []string // title types to load, "movie" when empty
+	IncludeAdult bool     // load titles flagged as adult
+}
+
+func (f IMDbFilter) keeps(item *Item, adult bool) bool {
+	if adult && !f.IncludeAdult {
+		return false
+	}
+	titleTypes := f.TitleTypes
+	if len(titleTypes) == 0 {
+		titleTypes = []string{"movie"}
+	}
+	for _, t := range titleTypes {
+		if strings.EqualFold(t, item.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadIMDb loads the titles of an IMDb title.basics file, gzipped or plain, that pass the filter.
+// Rows with missing columns are skipped and \N values are left empty; titles without a
+// runtime get a random one, as movies without a runtime in the CSV catalog do.
+func LoadIMDb(filename string, filter IMDbFilter, opts ...Option) (*Memory, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	// Skip header line
+	scanner.Scan()
+
+	var items []*Item
+	skipped := 0
+	for scanner.Scan() {
+		item, adult, ok := parseIMDbBasics(scanner.Text())
+		if !ok {
+			skipped++
+			continue
+		}
+		if filter.keeps(item, adult) {
+			items = append(items, item)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d malformed rows in %s", skipped, filename)
+	}
+	log.Printf("Loaded %d titles from %s", len(items), filename)
+	return NewMemory(items, opts...), nil
+}
+
+// parseIMDbBasics parses a title.basics row. ok is false when the row has too few columns.
+func parseIMDbBasics(line string) (item *Item, adult bool, ok bool) {
+	parts := strings.Split(line, "\t")
+	if len(parts) < imdbBasicsColumns {
+		return nil, false, false
+	}
+	for i, part := range parts {
+		if part == imdbNull {
+			parts[i] = ""
+		}
+	}
+
+	runtime := time.Duration(0)
+	if minutes, err := strconv.Atoi(parts[7]); err == nil && minutes > 0 {
+		runtime = time.Duration(minutes) * time.Minute
+	} else {
+		runtime, _ = parseRuntime("")
+	}
+	var genres []string
+	if parts[8] != "" {
+		genres = strings.Split(parts[8], ",")
+	}
+	year, _ := strconv.Atoi(parts[5])
+
+	return &Item{
+		ID:       parts[0],
+		Type:     parts[1],
+		Title:    parts[2],
+		Year:     year,
+		Runtime:  runtime,
+		Genres:   genres,
+		Released: releaseDate(year, parts[0]),
+	}, parts[4] == "1", true
+}
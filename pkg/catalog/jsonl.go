@@ -0,0 +1,61 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// jsonlItem is a line of a JSONL catalog. Runtimes are given in minutes.
+type jsonlItem struct {
+	Item
+	RuntimeMinutes float64 `json:"runtimeMinutes"`
+}
+
+// LoadJSONL loads a catalog with one JSON object per line, for example
+//
+//	{"id": "tt0111161", "title": "The Shawshank Redemption", "genres": ["Drama"], "runtimeMinutes": 142, "rating": 9.3, "votes": 2800000}
+//
+// Items without a release date are released in their year.
+// Blank lines are ignored; a line that is not valid JSON or has no id is an error.
+func LoadJSONL(filename string, opts ...Option) (*Memory, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var items []*Item
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record jsonlItem
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, line, err)
+		}
+		if record.ID == "" {
+			return nil, fmt.Errorf("%s:%d: item has no id", filename, line)
+		}
+		item := record.Item
+		item.Runtime = time.Duration(record.RuntimeMinutes * float64(time.Minute))
+		if item.Runtime <= 0 {
+			item.Runtime, _ = parseRuntime("")
+		}
+		if item.Released.IsZero() {
+			item.Released = releaseDate(item.Year, item.ID)
+		}
+		items = append(items, &item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewMemory(items, opts...), nil
+}
@@ -0,0 +1,137 @@
+package catalog
+
+import (
+	"strings"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// Window is a period during which an item is licensed, in some regions or everywhere.
+type Window struct {
+	Regions []string  // regions the item is licensed in, everywhere when empty
+	From    time.Time // start of the licence, open when zero
+	Until   time.Time // end of the licence, open when zero
+}
+
+func (w Window) covers(region string, at time.Time) bool {
+	if !w.From.IsZero() && at.Before(w.From) {
+		return false
+	}
+	if !w.Until.IsZero() && !at.Before(w.Until) {
+		return false
+	}
+	if len(w.Regions) == 0 || region == "" {
+		return true
+	}
+	for _, r := range w.Regions {
+		if strings.EqualFold(r, region) {
+			return true
+		}
+	}
+	return false
+}
+
+// License attaches a licence window to the items it names and to every item of its genres.
+type License struct {
+	Titles []string
+	Genres []string
+	Window Window
+}
+
+func (l License) covers(item *Item) bool {
+	for _, id := range l.Titles {
+		if id == item.ID {
+			return true
+		}
+	}
+	for _, genre := range item.Genres {
+		for _, g := range l.Genres {
+			if strings.EqualFold(g, genre) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithLicenses restricts the items the licences cover to their licence windows.
+func WithLicenses(licenses []License) Option {
+	return func(m *Memory) {
+		m.licenses = append(m.licenses, licenses...)
+	}
+}
+
+// AvailableIn reports whether the item can be watched in the region at the given time.
+// Items without licence windows are available everywhere, all the time; viewers whose
+// region is unknown see every title that is licensed somewhere.
+func (i *Item) AvailableIn(region string, at time.Time) bool {
+	if len(i.Licenses) == 0 {
+		return true
+	}
+	for _, w := range i.Licenses {
+		if w.covers(region, at) {
+			return true
+		}
+	}
+	return false
+}
+
+// AvailableUntil returns when the item stops being available in the region, following
+// back-to-back licence windows from the given time. It returns the given time when the
+// item is not available then, and the zero time when its licence does not end.
+func (i *Item) AvailableUntil(region string, at time.Time) time.Time {
+	if len(i.Licenses) == 0 {
+		return time.Time{}
+	}
+	until := at
+	for {
+		var next time.Time
+		for _, w := range i.Licenses {
+			if !w.covers(region, until) {
+				continue
+			}
+			if w.Until.IsZero() {
+				return time.Time{}
+			}
+			if w.Until.After(next) {
+				next = w.Until
+			}
+		}
+		if next.IsZero() {
+			return until
+		}
+		until = next
+	}
+}
+
+// licensesFromConfig turns the configured licences into licence windows for a simulation
+// starting at start.
+func licensesFromConfig(licenses []config.License, start time.Time) []License {
+	windows := make([]License, 0, len(licenses))
+	for _, l := range licenses {
+		windows = append(windows, License{
+			Titles: l.Titles,
+			Genres: l.Genres,
+			Window: Window{
+				Regions: l.Regions,
+				From:    licenseTime(l.From, l.FromDay, start),
+				Until:   licenseTime(l.Until, l.UntilDay, start),
+			},
+		})
+	}
+	return windows
+}
+
+// licenseTime reads a licence boundary given as a date or as days after the start.
+func licenseTime(date string, day *float64, start time.Time) time.Time {
+	if date != "" {
+		if t, err := time.Parse("2006-01-02", date); err == nil {
+			return t
+		}
+	}
+	if day != nil {
+		return start.Add(time.Duration(*day * float64(24*time.Hour)))
+	}
+	return time.Time{}
+}
@@ -0,0 +1,225 @@
+package catalog
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Memory is a catalog held in memory. It is the catalog every loader returns.
+type Memory struct {
+	items      []*Item
+	byID       map[string]*Item
+	byGenre    map[string]*pool
+	all        *pool
+	genres     []string
+	popularity Popularity
+	extra      []*Item
+	licenses   []License
+}
+
+// maxRejections is how many weighted picks land on unavailable items before a pick falls
+// back to weighing only the available ones.
+const maxRejections = 16
+
+// pool is a list of items to sample from. Back-stock titles, whose weight does not change
+// during the simulation, keep cumulative weights so weighted picks are a binary search.
+// Titles launched around the simulation are few and weighed at the time of the pick.
+type pool struct {
+	items      []*Item
+	stock      []*Item
+	cumulative []float64
+	launches   []*Item
+	launchBase []float64
+}
+
+// build ranks the pool's items by popularity and computes their weights.
+func (p *pool) build(model Popularity) {
+	ranked := append([]*Item(nil), p.items...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Popularity() > ranked[j].Popularity()
+	})
+	total := 0.0
+	for i, item := range ranked {
+		base := model.baseWeight(item, i+1)
+		if model.launched(item) {
+			p.launches = append(p.launches, item)
+			p.launchBase = append(p.launchBase, base)
+			continue
+		}
+		total += base
+		p.stock = append(p.stock, item)
+		p.cumulative = append(p.cumulative, total)
+	}
+}
+
+func (p *pool) samplePopular(rng *rand.Rand, model Popularity, at time.Time) *Item {
+	stockTotal := 0.0
+	if n := len(p.cumulative); n > 0 {
+		stockTotal = p.cumulative[n-1]
+	}
+	weights := make([]float64, len(p.launches))
+	total := stockTotal
+	for i, item := range p.launches {
+		weights[i] = model.weightAt(item, p.launchBase[i], at)
+		total += weights[i]
+	}
+	if total <= 0 {
+		return nil
+	}
+	r := rng.Float64() * total
+	if r < stockTotal {
+		i := sort.SearchFloat64s(p.cumulative, r)
+		if i >= len(p.stock) {
+			i = len(p.stock) - 1
+		}
+		return p.stock[i]
+	}
+	r -= stockTotal
+	for i, w := range weights {
+		if r < w {
+			return p.launches[i]
+		}
+		r -= w
+	}
+	for i := len(weights) - 1; i >= 0; i-- { // rounding left r at the very end of the range
+		if weights[i] > 0 {
+			return p.launches[i]
+		}
+	}
+	return nil
+}
+
+// sampleAvailable picks by weight among the items available for the query. It weighs every
+// item, so it is only used when most of the pool is unavailable.
+func (p *pool) sampleAvailable(rng *rand.Rand, model Popularity, q Query) *Item {
+	items := make([]*Item, 0, len(p.stock)+len(p.launches))
+	weights := make([]float64, 0, cap(items))
+	previous := 0.0
+	for i, item := range p.stock {
+		if item.AvailableIn(q.Region, q.At) {
+			items = append(items, item)
+			weights = append(weights, p.cumulative[i]-previous)
+		}
+		previous = p.cumulative[i]
+	}
+	for i, item := range p.launches {
+		if item.AvailableIn(q.Region, q.At) {
+			items = append(items, item)
+			weights = append(weights, model.weightAt(item, p.launchBase[i], q.At))
+		}
+	}
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return nil
+	}
+	r := rng.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return items[i]
+		}
+		r -= w
+	}
+	return items[len(items)-1]
+}
+
+// NewMemory builds a catalog of the items. When several items share an ID the first one is kept.
+// Items that licence windows apply to are copied, leaving the caller's items as they were.
+func NewMemory(items []*Item, opts ...Option) *Memory {
+	m := &Memory{
+		byID:    make(map[string]*Item, len(items)),
+		byGenre: make(map[string]*pool),
+		all:     &pool{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	candidates := append(append([]*Item(nil), items...), m.extra...)
+	for _, item := range candidates {
+		if _, ok := m.byID[item.ID]; ok {
+			continue
+		}
+		var windows []Window
+		for _, l := range m.licenses {
+			if l.covers(item) {
+				windows = append(windows, l.Window)
+			}
+		}
+		if len(windows) > 0 {
+			licensed := *item
+			licensed.Licenses = append(append([]Window(nil), item.Licenses...), windows...)
+			item = &licensed
+		}
+		m.byID[item.ID] = item
+		m.items = append(m.items, item)
+		m.all.items = append(m.all.items, item)
+		for _, genre := range item.Genres {
+			p, ok := m.byGenre[genre]
+			if !ok {
+				p = &pool{}
+				m.byGenre[genre] = p
+				m.genres = append(m.genres, genre)
+			}
+			p.items = append(p.items, item)
+		}
+	}
+	sort.Strings(m.genres)
+	m.all.build(m.popularity)
+	for _, p := range m.byGenre {
+		p.build(m.popularity)
+	}
+	return m
+}
+
+func (m *Memory) Get(id string) (*Item, bool) {
+	item, ok := m.byID[id]
+	return item, ok
+}
+
+func (m *Memory) Genres() []string {
+	return append([]string(nil), m.genres...)
+}
+
+func (m *Memory) Sample(rng *rand.Rand, genre string) *Item {
+	p := m.pool(genre)
+	if p == nil || len(p.items) == 0 {
+		return nil
+	}
+	return p.items[rng.Intn(len(p.items))]
+}
+
+func (m *Memory) SamplePopular(rng *rand.Rand, q Query) *Item {
+	p := m.pool(q.Genre)
+	if p == nil {
+		return nil
+	}
+	for attempt := 0; attempt < maxRejections; attempt++ {
+		item := p.samplePopular(rng, m.popularity, q.At)
+		if item == nil || item.AvailableIn(q.Region, q.At) {
+			return item
+		}
+	}
+	return p.sampleAvailable(rng, m.popularity, q)
+}
+
+func (m *Memory) Each(fn func(*Item) bool) {
+	for _, item := range m.items {
+		if !fn(item) {
+			return
+		}
+	}
+}
+
+func (m *Memory) Len() int {
+	return len(m.items)
+}
+
+func (m *Memory) pool(genre string) *pool {
+	if genre == "" {
+		return m.all
+	}
+	return m.byGenre[genre]
+}
@@ -0,0 +1,127 @@
+package catalog
+
+import (
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// launchHorizon is how many launch half-lives a title stays boosted; after ten the boost
+// is below a thousandth of its initial size and the title counts as catalog back stock.
+const launchHorizon = 10
+
+// Popularity models how likely titles are to be picked and how that changes over time.
+type Popularity struct {
+	ZipfExponent   float64       // weigh titles by 1/rank^s of their popularity in a genre; 0 weighs them by popularity itself
+	LaunchBoost    float64       // extra weight of a title on release, as a multiple of its usual weight
+	LaunchHalfLife time.Duration // time for the launch boost to halve
+	Since          time.Time     // start of the simulation; titles launched long before it are not boosted
+}
+
+// PopularityFromConfig returns the popularity model configured for a simulation starting at start.
+func PopularityFromConfig(cfg config.PopularityConfig, start time.Time) Popularity {
+	return Popularity{
+		ZipfExponent:   cfg.ZipfExponent,
+		LaunchBoost:    cfg.LaunchBoost,
+		LaunchHalfLife: time.Duration(cfg.LaunchHalfLifeDays * float64(24*time.Hour)),
+		Since:          start,
+	}
+}
+
+// Option configures a Memory catalog.
+type Option func(*Memory)
+
+// WithPopularity makes the catalog sample titles by the popularity model.
+func WithPopularity(p Popularity) Option {
+	return func(m *Memory) {
+		m.popularity = p
+	}
+}
+
+// WithItems adds items to the catalog besides the ones loaded from its source.
+func WithItems(items []*Item) Option {
+	return func(m *Memory) {
+		m.extra = append(m.extra, items...)
+	}
+}
+
+// launched reports whether the item's release date is recent or upcoming enough at the
+// start of the simulation that its weight changes while the simulation runs.
+func (p Popularity) launched(item *Item) bool {
+	if item.Released.IsZero() {
+		return false
+	}
+	horizon := time.Duration(0)
+	if p.LaunchHalfLife > 0 {
+		horizon = launchHorizon * p.LaunchHalfLife
+	}
+	return item.Released.After(p.Since.Add(-horizon))
+}
+
+// baseWeight is the weight of the item at the given popularity rank, counted from 1.
+func (p Popularity) baseWeight(item *Item, rank int) float64 {
+	if p.ZipfExponent > 0 {
+		return 1 / math.Pow(float64(rank), p.ZipfExponent)
+	}
+	return item.Popularity()
+}
+
+// weightAt is the weight of a launched item at the given time: nothing before its release,
+// then its base weight plus a launch boost that halves every half-life.
+func (p Popularity) weightAt(item *Item, base float64, at time.Time) float64 {
+	if item.Released.After(at) {
+		return 0
+	}
+	boost := item.LaunchBoost
+	if boost == 0 {
+		boost = p.LaunchBoost
+	}
+	if boost <= 0 || p.LaunchHalfLife <= 0 {
+		return base
+	}
+	age := at.Sub(item.Released)
+	return base * (1 + boost*math.Exp2(-float64(age)/float64(p.LaunchHalfLife)))
+}
+
+// releaseDate spreads titles known only by their year over that year, on a day that
+// depends on the title's ID so every run agrees on it.
+func releaseDate(year int, id string) time.Time {
+	if year <= 0 {
+		return time.Time{}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(h.Sum32()%365))
+}
+
+// premiereItems turns the configured premieres into items released during the simulation.
+func premiereItems(premieres []config.Premiere, start time.Time) []*Item {
+	items := make([]*Item, 0, len(premieres))
+	for _, p := range premieres {
+		released := start.Add(time.Duration(p.Day * float64(24*time.Hour)))
+		if p.Date != "" {
+			if date, err := time.Parse("2006-01-02", p.Date); err == nil {
+				released = date
+			}
+		}
+		runtime := time.Duration(p.RuntimeMinutes) * time.Minute
+		if runtime <= 0 {
+			runtime, _ = parseRuntime("")
+		}
+		items = append(items, &Item{
+			ID:          p.ID,
+			Title:       p.Title,
+			Type:        "movie",
+			Genres:      p.Genres,
+			Runtime:     runtime,
+			Year:        released.Year(),
+			Rating:      p.Rating,
+			Votes:       p.Votes,
+			Released:    released,
+			LaunchBoost: p.Boost,
+		})
+	}
+	return items
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AudioConfig holds the settings of the audio catalog and listening behaviour.
+type AudioConfig struct {
+	CatalogPath     string  `mapstructure:"catalog-path"`     // directory of song CSV/TSV files
+	SkipProbability float64 `mapstructure:"skip-probability"` // chance a listener skips a track before it ends
+	MinListen       int     `mapstructure:"min-listen"`       // seconds a track plays at least before it can be skipped
+}
+
+type Song struct {
+	SongID   string
+	Title    string
+	Artist   string
+	Album    string
+	Genre    string
+	Duration time.Duration
+}
+
+// songColumns maps the accepted header names of a song catalog to the Song fields.
+var songColumns = map[string]string{
+	"song_id":          "id",
+	"id":               "id",
+	"title":            "title",
+	"song":             "title",
+	"track":            "title",
+	"artist":           "artist",
+	"artist_name":      "artist",
+	"album":            "album",
+	"album_title":      "album",
+	"genre":            "genre",
+	"duration":         "duration",
+	"duration_seconds": "duration",
+	"length":           "duration",
+}
+
+// NextSong returns a random song from the audio catalog, or nil if no songs are loaded.
+func (cfg *Config) NextSong() *Song {
+	if len(cfg.Songs) == 0 {
+		return nil
+	}
+	return cfg.Songs[cfg.rng.Intn(len(cfg.Songs))]
+}
+
+// LoadSongs loads songs from a CSV or, for .tsv files, tab separated file with a header row.
+func (cfg *Config) LoadSongs(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	if strings.HasSuffix(filePath, ".tsv") {
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	}
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("reading header of %s: %w", filePath, err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		if field, ok := songColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			columns[field] = i
+		}
+	}
+	if _, ok := columns["title"]; !ok {
+		return fmt.Errorf("%s has no title column", filePath)
+	}
+	if _, ok := columns["duration"]; !ok {
+		return fmt.Errorf("%s has no duration column", filePath)
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		duration, err := parseSongDuration(field(record, "duration"))
+		if err != nil {
+			log.Printf("Skipping song due to invalid duration: %v", err)
+			continue
+		}
+		song := &Song{
+			SongID:   field(record, "id"),
+			Title:    field(record, "title"),
+			Artist:   field(record, "artist"),
+			Album:    field(record, "album"),
+			Genre:    field(record, "genre"),
+			Duration: duration,
+		}
+		if song.SongID == "" {
+			song.SongID = fmt.Sprintf("song-%d", len(cfg.Songs)+1)
+		}
+		cfg.Songs = append(cfg.Songs, song)
+	}
+	return nil
+}
+
+// parseSongDuration accepts a positive duration in seconds ("245") or minutes and seconds
+// ("4:05").
+func parseSongDuration(s string) (time.Duration, error) {
+	var duration time.Duration
+	if minutes, seconds, ok := strings.Cut(s, ":"); ok {
+		m, err := strconv.Atoi(minutes)
+		if err != nil {
+			return 0, err
+		}
+		sec, err := strconv.Atoi(seconds)
+		if err != nil {
+			return 0, err
+		}
+		if m < 0 || sec < 0 || sec >= 60 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		duration = time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	} else {
+		seconds, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		duration = time.Duration(seconds * float64(time.Second))
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("non-positive duration %q", s)
+	}
+	return duration, nil
+}
+
+// InitializeSongs loads every CSV and TSV song file under filePath into the audio catalog.
+func (c *Config) InitializeSongs(filePath string) error {
+	c.Songs = nil
+	if c.rng == nil {
+		c.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return filepath.Walk(filePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && (strings.HasSuffix(info.Name(), ".csv") || strings.HasSuffix(info.Name(), ".tsv")) {
+			if err := c.LoadSongs(path); err != nil {
+				log.Printf("Failed to load songs: %v", err)
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSongDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration // 0 when the duration is rejected
+	}{
+		{"245", 245 * time.Second},
+		{"4:05", 4*time.Minute + 5*time.Second},
+		{"0:30", 30 * time.Second},
+		{"12.5", 12500 * time.Millisecond},
+		{"0:00", 0},
+		{"0", 0},
+		{"-5", 0},
+		{"-1:30", 0},
+		{"1:-30", 0},
+		{"1:75", 0},
+		{"four", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseSongDuration(tt.in)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("parseSongDuration(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSongDuration(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
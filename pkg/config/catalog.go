@@ -0,0 +1,50 @@
+package config
+
+// DefaultMovieCatalogPath is the directory of the bundled movie CSV files.
+const DefaultMovieCatalogPath = "data/imdb_movie_dataset"
+
+// CatalogConfig selects where the video catalog is loaded from.
+type CatalogConfig struct {
+	Source       string   `mapstructure:"source"`        // "csv" (default), "imdb" or "jsonl"
+	Path         string   `mapstructure:"path"`          // directory of movie CSV files, an IMDb title.basics.tsv(.gz) file or a JSONL file
+	TitleTypes   []string `mapstructure:"title-types"`   // IMDb title types to load, "movie" when empty
+	IncludeAdult bool     `mapstructure:"include-adult"` // load IMDb titles flagged as adult
+
+	Popularity PopularityConfig `mapstructure:"popularity"`
+	Premieres  []Premiere       `mapstructure:"premieres"`
+	Licenses   []License        `mapstructure:"licenses"`
+}
+
+// License makes titles available only within a window and, optionally, only in some
+// regions. Titles no licence covers are available everywhere for the whole simulation;
+// titles several licences cover are available wherever and whenever any of them allows.
+type License struct {
+	Titles   []string `mapstructure:"titles"`    // IDs of the titles the licence covers
+	Genres   []string `mapstructure:"genres"`    // genres whose titles the licence covers
+	Regions  []string `mapstructure:"regions"`   // regions the titles are available in, everywhere when empty
+	From     string   `mapstructure:"from"`      // start of the window as 2006-01-02
+	Until    string   `mapstructure:"until"`     // end of the window as 2006-01-02
+	FromDay  *float64 `mapstructure:"from-day"`  // start of the window as days after the simulation start, used when there is no from date
+	UntilDay *float64 `mapstructure:"until-day"` // end of the window as days after the simulation start, used when there is no until date
+}
+
+// PopularityConfig shapes how likely titles are to be picked and how that changes over time.
+type PopularityConfig struct {
+	ZipfExponent       float64 `mapstructure:"zipf-exponent"`         // weigh titles by 1/rank^s of their popularity in a genre, 0 weighs them by popularity itself
+	LaunchBoost        float64 `mapstructure:"launch-boost"`          // extra weight of a title on release, as a multiple of its usual weight
+	LaunchHalfLifeDays float64 `mapstructure:"launch-half-life-days"` // days for the launch boost to halve
+}
+
+// Premiere schedules a title to be released during the simulation, such as a hit whose
+// launch spike trending-content jobs should pick up.
+type Premiere struct {
+	ID             string   `mapstructure:"id"`
+	Title          string   `mapstructure:"title"`
+	Genres         []string `mapstructure:"genres"`
+	RuntimeMinutes int      `mapstructure:"runtime-minutes"`
+	Date           string   `mapstructure:"date"`   // release date as 2006-01-02
+	Day            float64  `mapstructure:"day"`    // release as days after the simulation start, used when there is no date
+	Boost          float64  `mapstructure:"boost"`  // launch boost of the title, the popularity launch-boost when 0
+	Rating         float64  `mapstructure:"rating"` // expected rating, ranks the title among the catalog
+	Votes          int      `mapstructure:"votes"`  // expected audience size, ranks the title among the catalog
+}
@@ -1,17 +1,10 @@
 package config
 
 import (
-	"bufio"
-	"compress/gzip"
-	"encoding/csv"
-	"errors"
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"math/rand"
-	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -31,6 +24,23 @@ type AdEvent struct {
 	Weight int    `mapstructure:"weight"`
 }
 
+// AdTargeting restricts which ad slots a campaign bids on. Empty lists match everything.
+type AdTargeting struct {
+	Genres  []string `mapstructure:"genres"`  // genres of the content being watched
+	Tiers   []string `mapstructure:"tiers"`   // subscription tiers
+	Devices []string `mapstructure:"devices"` // device types
+}
+
+// AdCampaign defines an advertiser campaign, its bidding and the per-user frequency caps applied to it
+type AdCampaign struct {
+	Name         string      `mapstructure:"name"`
+	Bid          float64     `mapstructure:"bid"`           // maximum price paid per impression
+	Budget       float64     `mapstructure:"budget"`        // total spend over the simulation window, 0 means unlimited
+	Targeting    AdTargeting `mapstructure:"targeting"`
+	FrequencyCap int         `mapstructure:"frequency-cap"` // max impressions per user over the whole simulation, 0 means uncapped
+	DailyCap     int         `mapstructure:"daily-cap"`     // max impressions per user per day, 0 means uncapped
+}
+
 // AdConfig holds the configuration for advertisement behavior in audio and video streams
 type AdConfig struct {
 	AudioAdFrequency  float64   `mapstructure:"audio-ad-frequency"`
@@ -39,21 +49,55 @@ type AdConfig struct {
 	PreRollFrequency  float64   `mapstructure:"pre-roll-ad-frequency"` 
 	PreRollCooldown   time.Duration `mapstructure:"pre-roll-ad-cooldown"`  
 	MidRollWindow     time.Duration `mapstructure:"mid-roll-ad-window"` 
+	Campaigns         []AdCampaign  `mapstructure:"campaigns"`
+	FloorPrice        float64       `mapstructure:"floor-price"`     // reserve price of every ad slot auction
+	MaxAdsPerDay      int           `mapstructure:"max-ads-per-day"` // per user across all campaigns, 0 means uncapped
+	FatigueFactor     float64       `mapstructure:"fatigue-factor"`  // added chance of abandoning the session for each ad already seen in it
 }
 
 type Transition struct {
-	Source StateConfig `mapstructure:"source"`
-	Dest   StateConfig `mapstructure:"dest"`
-	P      float64     `mapstructure:"p"`  // Probability of this transition
+	Source StateConfig `mapstructure:"source" json:"source"`
+	Dest   StateConfig `mapstructure:"dest" json:"dest"`
+	Type   string      `mapstructure:"type" json:"type,omitempty"` // "lateral" (default), or "upgrade" and "downgrade" for transitions that change the auth or level
+	History []string   `mapstructure:"history" json:"history,omitempty"` // pages viewed before the source, the most recent last; the transition is only taken after them
+	P      float64     `mapstructure:"p" json:"p"`  // Probability of this transition
+	Overrides []TransitionOverride `mapstructure:"overrides" json:"overrides,omitempty"` // probabilities that replace P in some contexts, the first that matches wins
+}
+
+// TransitionOverride replaces the probability of a transition when the session is in the
+// context its conditions describe.
+type TransitionOverride struct {
+	When TransitionCondition `mapstructure:"when" json:"when"`
+	P    float64             `mapstructure:"p" json:"p"`
+}
+
+// TransitionCondition describes a session context. Every condition that is set has to hold.
+type TransitionCondition struct {
+	Hours    []int    `mapstructure:"hours" json:"hours,omitempty"`       // hours of the day, 0 to 23, in UTC
+	Weekdays []string `mapstructure:"weekdays" json:"weekdays,omitempty"` // e.g. "Saturday"
+	Devices  []string `mapstructure:"devices" json:"devices,omitempty"`   // device types, e.g. "smartphone"
+	Tiers    []string `mapstructure:"tiers" json:"tiers,omitempty"`       // subscription tiers
+	MinItem  int      `mapstructure:"min-item" json:"min-item,omitempty"` // lowest item in session
+	MaxItem  int      `mapstructure:"max-item" json:"max-item,omitempty"` // highest item in session, no limit when 0
+}
+
+// ParseWeekday returns the weekday with the given name, e.g. "Saturday" or "sat".
+func ParseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(name, day.String()) || strings.EqualFold(name, day.String()[:3]) {
+			return day, true
+		}
+	}
+	return 0, false
 }
 // SessionPage defines the configuration for different pages that can be accessed in a session.
 type SessionPage struct {
-	Page    string `mapstructure:"page"`
-	Method  string `mapstructure:"method"`
-	Status  int    `mapstructure:"status"`
-	Auth    string `mapstructure:"auth"`
-	Level   string `mapstructure:"level"`
-	Weight  int    `mapstructure:"weight"`
+	Page    string `mapstructure:"page" json:"page"`
+	Method  string `mapstructure:"method" json:"method"`
+	Status  int    `mapstructure:"status" json:"status"`
+	Auth    string `mapstructure:"auth" json:"auth"`
+	Level   string `mapstructure:"level" json:"level"`
+	Weight  int    `mapstructure:"weight" json:"weight"`
 }
 // {
     // "ad-config": {
@@ -67,41 +111,116 @@ type SessionPage struct {
 //   }
 
 type StateConfig struct {
-	Page   string `mapstructure:"page"`
-	Method string `mapstructure:"method"`
-	Status int    `mapstructure:"status"`
-	Auth   string `mapstructure:"auth"`
-	Level  string `mapstructure:"level"`
+	Page   string `mapstructure:"page" json:"page"`
+	Method string `mapstructure:"method" json:"method"`
+	Status int    `mapstructure:"status" json:"status"`
+	Auth   string `mapstructure:"auth" json:"auth"`
+	Level  string `mapstructure:"level" json:"level"`
+}
+
+// String describes the state, e.g. GET Home 200 (Logged In, free).
+func (c StateConfig) String() string {
+	return fmt.Sprintf("%s %s %d (%s, %s)", c.Method, c.Page, c.Status, c.Auth, c.Level)
 }
 
 type Preference struct {
-	Name   string `mapstructure:"name"`
-	Weight int    `mapstructure:"weight"`
+	Name   string `mapstructure:"name" json:"name"`
+	Weight int    `mapstructure:"weight" json:"weight"`
 }
 
 type SubscriptionChance struct {
-	Type  string  `mapstructure:"type"`
-	Chance float64 `mapstructure:"chance"`
+	Type  string  `mapstructure:"type" json:"type"`
+	Chance float64 `mapstructure:"chance" json:"chance"`
+}
+
+// SubscriptionTier defines what a subscription tier unlocks: its session level, how many
+// ad slots are filled, the genres of the catalog it can watch and the pages it cannot reach.
+type SubscriptionTier struct {
+	Name         string   `mapstructure:"name"`
+	Level        string   `mapstructure:"level"`         // session level ("free" or "paid") the tier maps to
+	Price        float64  `mapstructure:"price"`         // price per billing cycle in the base currency
+	AdLoad       float64  `mapstructure:"ad-load"`       // share of ad slots that are filled, 1 shows every ad and 0 none
+	Genres       []string `mapstructure:"genres"`        // catalog genres available to the tier, empty means the whole catalog
+	BlockedPages []string `mapstructure:"blocked-pages"` // pages the tier never transitions to
+}
+
+// SubscriptionLifecycle configures free trials and how cancellations take effect.
+type SubscriptionLifecycle struct {
+	TrialTier       string  `mapstructure:"trial-tier"`        // tier granted during a free trial
+	TrialDays       int     `mapstructure:"trial-days"`        // length of a free trial
+	TrialChance     float64 `mapstructure:"trial-chance"`      // chance that a user's first upgrade starts a trial
+	TrialConversion float64 `mapstructure:"trial-conversion"`  // chance that a trial converts to a paid subscription at expiry
+	GracePeriodDays int     `mapstructure:"grace-period-days"` // days a cancelled subscription stays active
+}
+
+// BillingConfig configures billing cycles, payment failures with their dunning retries and refunds.
+type BillingConfig struct {
+	CycleDays          int     `mapstructure:"cycle-days"`           // length of a billing cycle
+	PaymentFailureRate float64 `mapstructure:"payment-failure-rate"` // chance that a charge attempt fails
+	MaxRetries         int     `mapstructure:"max-retries"`          // retries of a failed charge before the plan is downgraded
+	RetryIntervalDays  int     `mapstructure:"retry-interval-days"`  // days between retries of a failed charge
+	RefundRate         float64 `mapstructure:"refund-rate"`          // chance that leaving a paid plan refunds the last charge
+}
+
+// Region defines where users live and the currency they are billed in.
+type Region struct {
+	Name            string  `mapstructure:"name"`
+	Weight          int     `mapstructure:"weight"`
+	Currency        string  `mapstructure:"currency"`
+	PriceMultiplier float64 `mapstructure:"price-multiplier"` // converts base plan prices into the local currency
+}
+
+// Show describes a TV series: how often users pick it and how its episodes are laid out.
+type Show struct {
+	ID             string   `mapstructure:"id"`
+	Name           string   `mapstructure:"name"`
+	Weight         int      `mapstructure:"weight"`
+	Genres         []string `mapstructure:"genres"`
+	Seasons        []int    `mapstructure:"seasons"`         // number of episodes in each season
+	EpisodeMinutes int      `mapstructure:"episode-minutes"` // runtime of an episode
+}
+
+// SeriesConfig configures how users pick and binge-watch series.
+type SeriesConfig struct {
+	ShowShare        float64 `mapstructure:"show-share"`        // chance that newly picked content is a series rather than a movie
+	Autoplay         float64 `mapstructure:"autoplay"`          // chance the next episode plays when an episode ends while still being watched
+	BingeProbability float64 `mapstructure:"binge-probability"` // chance a user resumes a series in progress instead of picking new content
+}
+
+// PlaybackConfig configures how viewers watch a title: when they give up on it, how they
+// pause and seek, and how often players report their position.
+type PlaybackConfig struct {
+	HeartbeatSeconds    int     `mapstructure:"heartbeat-seconds"`    // interval of heartbeats while playing, none when 0
+	AbandonRate         float64 `mapstructure:"abandon-rate"`         // chance per hour watched that a viewer gives up on a title they have no affinity for
+	AffinityWeight      float64 `mapstructure:"affinity-weight"`      // how much affinity for a title's genres lowers the abandon rate, 1 removes it for favourite genres
+	CompletionThreshold float64 `mapstructure:"completion-threshold"` // share of a title to reach for a complete watch, 0.9 when 0
+	SeekRate            float64 `mapstructure:"seek-rate"`            // seeks per hour watched
+	SeekBackChance      float64 `mapstructure:"seek-back-chance"`     // share of seeks that go back
+	MaxSeekSeconds      int     `mapstructure:"max-seek-seconds"`     // longest seek
+	PauseRate           float64 `mapstructure:"pause-rate"`           // pauses per hour watched
+	MeanPauseSeconds    float64 `mapstructure:"mean-pause-seconds"`   // average length of a pause
 }
 
-type Movie struct {
-	MovieID   string
-	Name      string
-	RuntimeMinutes time.Duration
-	Genres    []string
-	Star      string
+// LiveEvent schedules a live stream, such as a sports match or a concert, that a share of
+// the users active around its start tunes into.
+type LiveEvent struct {
+	ID                string  `mapstructure:"id"`
+	Title             string  `mapstructure:"title"`               // named after a catalog title of the genre when empty
+	Genre             string  `mapstructure:"genre"`               // e.g. "Sport" or "Music"
+	Start             string  `mapstructure:"start"`               // start as 2006-01-02T15:04:05Z07:00
+	StartDay          float64 `mapstructure:"start-day"`           // start as days after the simulation start, used when there is no start time
+	DurationMinutes   int     `mapstructure:"duration-minutes"`    // length of the stream, 120 when 0
+	JoinShare         float64 `mapstructure:"join-share"`          // share of active users that tune in
+	JoinSpreadMinutes float64 `mapstructure:"join-spread-minutes"` // standard deviation of join times around the start
+	MeanStayMinutes   float64 `mapstructure:"mean-stay-minutes"`   // average time a viewer stays, until the end when 0
+	HeartbeatSeconds  int     `mapstructure:"heartbeat-seconds"`   // interval of heartbeats while tuned in, the playback heartbeat-seconds when 0
 }
 
-type Video struct {
-	ID             string
-	TitleType      string
-	PrimaryTitle   string
-	OriginalTitle  string
-	IsAdult        bool
-	StartYear      string
-	EndYear        string
-	RuntimeMinutes time.Duration
-	Genres         []string
+// TasteConfig configures how users' genre preferences evolve with what they watch.
+type TasteConfig struct {
+	Decay          float64 `mapstructure:"decay"`           // factor every preference keeps after each completed watch, 1 means no decay
+	LearningRate   float64 `mapstructure:"learning-rate"`   // boost of a watched genre, as a share of the user's average preference
+	NoveltySeeking float64 `mapstructure:"novelty-seeking"` // chance a user ignores their preferences when picking a genre
 }
 
 type Config struct {
@@ -122,14 +241,24 @@ type Config struct {
 	ContentTypes         []ContentType        `mapstructure:"content-types"`
 	AdConfig             AdConfig             `mapstructure:"ad-config"`
 	Genres               []Preference         `mapstructure:"genres"`
-	Shows                []Preference         `mapstructure:"shows"`
+	Shows                []Show               `mapstructure:"shows"`
+	Series               SeriesConfig         `mapstructure:"series"`
 	Levels               []Preference         `mapstructure:"levels"`
 	AuthLevels           []Preference         `mapstructure:"auth-levels"`
 	SubscriptionChances  []SubscriptionChance `mapstructure:"subscription-chances"`
+	SubscriptionTiers    []SubscriptionTier   `mapstructure:"subscription-tiers"`
+	SubscriptionLifecycle SubscriptionLifecycle `mapstructure:"subscription-lifecycle"`
+	Billing              BillingConfig        `mapstructure:"billing"`
+	Regions              []Region             `mapstructure:"regions"`
+	Taste                TasteConfig          `mapstructure:"taste"`
+	Playback             PlaybackConfig       `mapstructure:"playback"`
+	LiveEvents           []LiveEvent          `mapstructure:"live-events"`
 	NewSessionPages      []SessionPage    		`mapstructure:"new-session"`
 	Transitions      		 []Transition 				`mapstructure:"transitions"`	
-	Movies   						 []*Movie							`mapstructure:"movies"` // List of movies to be used as "video" content
-	GenreMap 						 map[string][]*Movie	`mapstructure:"genre-map"` // Map of genres to movies
+	Dwell                []DwellConfig        `mapstructure:"dwell"` // dwell times of pages, tried in order; redirects follow after a second unless an entry matches them
+	Catalog              CatalogConfig        `mapstructure:"catalog"`
+	Audio                AudioConfig          `mapstructure:"audio"`
+	Songs                []*Song              `mapstructure:"songs"` // Audio catalog used for "NextSong" events
 
 	SimulateVideo     		bool          			`mapstructure:"simulate-video"` 
 	AttritionRate     		float64       			`mapstructure:"attrition-rate"`
@@ -142,36 +271,36 @@ type Config struct {
 	rng      							*rand.Rand
 }
 
-// NextMovie returns a random movie based on genre weighting.
-func (cfg *Config) NextMovie() *Movie {
-	genreKeys := make([]string, 0, len(cfg.GenreMap))
-	for k := range cfg.GenreMap {
-			genreKeys = append(genreKeys, k)
+// Tier returns the configuration of the named subscription tier, matched case-insensitively.
+func (cfg *Config) Tier(name string) (SubscriptionTier, bool) {
+	for _, tier := range cfg.SubscriptionTiers {
+		if strings.EqualFold(tier.Name, name) {
+			return tier, true
+		}
 	}
-	randomGenre := genreKeys[cfg.rng.Intn(len(genreKeys))]
-	movies := cfg.GenreMap[randomGenre]
-	return movies[cfg.rng.Intn(len(movies))]
+	return SubscriptionTier{}, false
 }
 
 
-// LoadConfig initializes and reads the configuration using Viper
-func LoadConfig(cfgFile string) (*Config, error) {
-	if cfgFile != "" {
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Default config location
-		viper.AddConfigPath("configs")
-		viper.SetConfigName("config")
-		viper.SetConfigType("json")
+// LoadConfig reads the configuration using Viper: the config file, by default
+// configs/config.json, with the profiles laid over it and the SIMSTREAM_ environment
+// variables, see LoadLayers. Flags bound to Viper override them.
+func LoadConfig(cfgFile string, profiles ...string) (*Config, error) {
+	layers, err := LoadLayers(cfgFile, profiles)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := json.Marshal(layers.Values)
+	if err != nil {
+		return nil, fmt.Errorf("error merging config: %w", err)
 	}
-
-	viper.AutomaticEnv() // Read in environment variables that match
 
 	// Set default for start time as the current time if not provided
 	viper.SetDefault("start-time", time.Now().Format(time.RFC3339))
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
+	viper.SetConfigType("json")
+	if err := viper.ReadConfig(bytes.NewReader(merged)); err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
 	}
 
 	var config Config
@@ -187,132 +316,3 @@ func LoadConfig(cfgFile string) (*Config, error) {
 
 	return &config, nil
 }
-
-func LoadVideosFromIMDb(filename string) ([]Video, error) {
-    file, err := os.Open(filename)
-    if err != nil {
-        return nil, err
-    }
-    defer file.Close()
-
-    gz, err := gzip.NewReader(file)
-    if err != nil {
-        return nil, err
-    }
-    defer gz.Close()
-
-    scanner := bufio.NewScanner(gz)
-    videos := []Video{}
-
-    // Skip header line
-    scanner.Scan()
-
-    for scanner.Scan() {
-        line := scanner.Text()
-        parts := strings.Split(line, "\t")
-
-        runtimeMinutes, _ := strconv.Atoi(parts[7])
-        genres := strings.Split(parts[8], ",")
-
-        video := Video{
-					ID:             parts[0],
-					TitleType:      parts[1],
-					PrimaryTitle:   parts[2],
-					OriginalTitle:  parts[3],
-					IsAdult:        parts[4] == "1",
-					StartYear:      parts[5],
-					EndYear:        parts[6],
-					RuntimeMinutes: time.Duration(runtimeMinutes) * time.Minute,
-					Genres:         genres,
-        }
-        videos = append(videos, video)
-    }
-
-    if err := scanner.Err(); err != nil {
-      return nil, err
-    }
-    return videos, nil
-}
-
-// LoadMovies loads movies from a CSV file.
-func (cfg *Config) LoadMovies(filePath string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-			return err
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.Read()       
-
-	for {
-			record, err := reader.Read()
-			if err == io.EOF {
-					break
-			}
-			if err != nil {
-					return err
-			}
-
-			runtime, err := parseRuntime(record[4])
-			if err != nil {
-				log.Printf("Skipping movie due to invalid runtime: %v", err)
-				continue
-			}
-
-			movie := &Movie{
-					MovieID:        record[0],
-					Name:           record[1],
-					RuntimeMinutes: runtime,
-					Genres:         strings.Split(record[5], ", "),
-					Star:           record[10],
-			}
-			cfg.Movies = append(cfg.Movies, movie)
-			for _, genre := range movie.Genres {
-				cfg.GenreMap[genre] = append(cfg.GenreMap[genre], movie)
-			}
-	}
-
-	return nil
-}
-
-// parseRuntime converts a runtime string "180 min" to time.Duration
-func parseRuntime(s string) (time.Duration, error) {
-	if len(s) == 0 {
-		randomMinutes := rand.Intn(121) + 60 
-		return time.Duration(randomMinutes) * time.Minute, nil
-	}
-	parts := strings.Fields(s)
-	if len(parts) != 2 || parts[1] != "min" {
-			return 0, errors.New("invalid runtime format")
-	}
-	numberPart := strings.Replace(parts[0], ",", "", -1)
-	minutes, err := strconv.Atoi(numberPart)
-	if err != nil {
-		return 0, err
-	}
-	return time.Duration(minutes) * time.Minute, nil
-}
-
-
-func (c *Config) InitializeMovies(filePath string) error {
-	c.GenreMap = make(map[string][]*Movie)
-	c.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
-	err := filepath.Walk(filePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".csv") {
-			if err := c.LoadMovies(path); err != nil {
-				log.Printf("Failed to load movies: %v", err)
-				return err
-			}
-		}
-		return nil
-	})
-
-	if err != nil {
-		return err
-	}
-	return nil
-}
\ No newline at end of file
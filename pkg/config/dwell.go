@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DwellConfig sets how long users stay on the pages it matches before their next page view.
+// Pages no entry matches use an exponential dwell time with mean alpha.
+type DwellConfig struct {
+	Page         string     `mapstructure:"page"`         // page the entry applies to, every page when empty
+	Status       string     `mapstructure:"status"`       // status the entry applies to: a code such as "404", a class such as "3xx", or every status when empty
+	Distribution string     `mapstructure:"distribution"` // "exponential" (default), "log-normal", "gamma", "fixed" or "empirical"
+	Mean         float64    `mapstructure:"mean"`         // mean dwell in seconds, alpha when 0; the dwell itself for fixed
+	StdDev       float64    `mapstructure:"stddev"`       // standard deviation in seconds of a log-normal dwell
+	Shape        float64    `mapstructure:"shape"`        // shape of a gamma dwell; 1 is exponential, higher values cluster around the mean
+	Histogram    []DwellBin `mapstructure:"histogram"`    // bins of an empirical dwell
+}
+
+// DwellBin is a bin of an empirical dwell histogram, running from the upper bound of the
+// previous bin, or 0, to Upper.
+type DwellBin struct {
+	Upper  float64 `mapstructure:"upper"`  // upper bound in seconds
+	Weight float64 `mapstructure:"weight"` // relative share of page views in the bin
+}
+
+// Matches reports whether the entry applies to the page and status.
+func (d DwellConfig) Matches(page string, status int) bool {
+	if d.Page != "" && d.Page != page {
+		return false
+	}
+	switch {
+	case d.Status == "":
+		return true
+	case strings.HasSuffix(strings.ToLower(d.Status), "xx"):
+		return strconv.Itoa(status/100) == d.Status[:len(d.Status)-2]
+	default:
+		return strconv.Itoa(status) == d.Status
+	}
+}
+
+// MeanSeconds returns the mean dwell in seconds, using alpha when the entry sets no mean.
+func (d DwellConfig) MeanSeconds(alpha float64) float64 {
+	if d.Distribution == "empirical" {
+		lower, total, sum := 0.0, 0.0, 0.0
+		for _, bin := range d.Histogram {
+			total += bin.Weight
+			sum += bin.Weight * (lower + bin.Upper) / 2
+			lower = bin.Upper
+		}
+		if total <= 0 {
+			return 0
+		}
+		return sum / total
+	}
+	if d.Mean > 0 {
+		return d.Mean
+	}
+	return alpha
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix starts the names of environment variables that override settings. The rest of
+// the name is the setting's path in upper case, with _ for - and __ between nested keys:
+// SIMSTREAM_ALPHA sets alpha and SIMSTREAM_PLAYBACK__ABANDON_RATE sets playback.abandon-rate.
+// Values are read as JSON when they parse as JSON, and as strings otherwise.
+const EnvPrefix = "SIMSTREAM_"
+
+// ProfileEnv names the environment variable listing the profiles to load, separated by
+// commas, when none are given.
+const ProfileEnv = EnvPrefix + "PROFILE"
+
+// Layers is a configuration merged from a base config file, the profiles laid over it,
+// environment variables and, once ApplyViper is called, flags and defaults, recording the
+// layer each value came from.
+type Layers struct {
+	Values  map[string]interface{} // merged settings, as decoded JSON
+	Sources map[string]string      // layer each value was set by, keyed by JSON path, e.g. $.regions[1].weight
+}
+
+// LoadLayers reads the base config file, by default configs/config.json, and lays each
+// profile over it in order, then the SIMSTREAM_ environment variables. A profile is a
+// config file path, or a name looked up in the profiles directory next to the base
+// config, e.g. configs/profiles/black-friday.json for black-friday.
+//
+// Objects are merged key by key. Lists of objects that all have a name, or else an id, are
+// merged by it: an entry of the profile updates the entry with the same name and other
+// entries are added. Any other value, including other lists, replaces the one below it.
+func LoadLayers(cfgFile string, profiles []string) (*Layers, error) {
+	base := viper.New()
+	if cfgFile != "" {
+		base.SetConfigFile(cfgFile)
+	} else {
+		base.AddConfigPath("configs")
+		base.SetConfigName("config")
+		base.SetConfigType("json")
+	}
+	if err := base.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	layers := &Layers{Values: make(map[string]interface{}), Sources: make(map[string]string)}
+	layers.merge(layers.Values, base.AllSettings(), "$", base.ConfigFileUsed())
+
+	if len(profiles) == 0 && os.Getenv(ProfileEnv) != "" {
+		profiles = strings.Split(os.Getenv(ProfileEnv), ",")
+	}
+	for _, profile := range profiles {
+		profile = strings.TrimSpace(profile)
+		if profile == "" {
+			continue
+		}
+		v := viper.New()
+		if filepath.Ext(profile) != "" || strings.ContainsRune(profile, filepath.Separator) {
+			v.SetConfigFile(profile)
+		} else {
+			v.AddConfigPath(filepath.Join(filepath.Dir(base.ConfigFileUsed()), "profiles"))
+			v.SetConfigName(profile)
+		}
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("error reading profile %s: %w", profile, err)
+		}
+		layers.merge(layers.Values, v.AllSettings(), "$", fmt.Sprintf("profile %s (%s)", profile, v.ConfigFileUsed()))
+	}
+
+	if err := layers.applyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	return layers, nil
+}
+
+// ApplyViper lays the settings v holds besides the config files over the layers, with the
+// precedence LoadConfig gives them: a flag given on the command line, as changed reports,
+// overrides every layer, while flag defaults and Viper defaults only fill in the settings
+// no layer sets. Pass the Viper the command's flags are bound to.
+func (l *Layers) ApplyViper(v *viper.Viper, changed func(key string) bool) {
+	keys := v.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		var source string
+		switch _, set := l.Values[key]; {
+		case changed(key):
+			source = "flag --" + key
+		case !set:
+			source = "default"
+		default:
+			continue
+		}
+		value := v.Get(key)
+		if text, ok := value.(string); ok {
+			// Viper returns most flags as their text; read it like an environment variable
+			var parsed interface{}
+			if err := json.Unmarshal([]byte(text), &parsed); err == nil {
+				value = parsed
+			}
+		}
+		l.merge(l.Values, map[string]interface{}{key: value}, "$", source)
+	}
+}
+
+// applyEnv sets the values of the SIMSTREAM_ environment variables, see EnvPrefix.
+func (l *Layers) applyEnv(environ []string) error {
+	sort.Strings(environ)
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) || name == ProfileEnv {
+			continue
+		}
+		var keys []string
+		for _, key := range strings.Split(strings.TrimPrefix(name, EnvPrefix), "__") {
+			if key == "" {
+				return fmt.Errorf("environment variable %s: empty key", name)
+			}
+			keys = append(keys, strings.ReplaceAll(strings.ToLower(key), "_", "-"))
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			parsed = value
+		}
+		values, path := l.Values, "$"
+		for _, key := range keys[:len(keys)-1] {
+			path += "." + key
+			next, ok := values[key].(map[string]interface{})
+			if !ok {
+				if _, exists := values[key]; exists {
+					return fmt.Errorf("environment variable %s: %s is not an object", name, path)
+				}
+				next = make(map[string]interface{})
+				values[key] = next
+			}
+			values = next
+		}
+		l.merge(values, map[string]interface{}{keys[len(keys)-1]: parsed}, path, "env "+name)
+	}
+	return nil
+}
+
+// merge lays src over dst, recording source for the values it sets.
+func (l *Layers) merge(dst, src map[string]interface{}, path, source string) {
+	for key, value := range src {
+		keyPath := path + "." + key
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if below, ok := dst[key].(map[string]interface{}); ok {
+				l.merge(below, v, keyPath, source)
+				continue
+			}
+		case []interface{}:
+			if below, ok := dst[key].([]interface{}); ok && listKey(below) != "" && listKey(below) == listKey(v) {
+				dst[key] = l.mergeList(below, v, keyPath, source)
+				continue
+			}
+		}
+		dst[key] = value
+		l.replace(keyPath, value, source)
+	}
+}
+
+// mergeList merges a list of objects by the key listKey returns.
+func (l *Layers) mergeList(dst, src []interface{}, path, source string) []interface{} {
+	key := listKey(dst)
+	for _, value := range src {
+		entry := value.(map[string]interface{})
+		found := false
+		for i, below := range dst {
+			if below := below.(map[string]interface{}); below[key] == entry[key] {
+				l.merge(below, entry, fmt.Sprintf("%s[%d]", path, i), source)
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, entry)
+			l.replace(fmt.Sprintf("%s[%d]", path, len(dst)-1), entry, source)
+		}
+	}
+	return dst
+}
+
+// listKey returns "name" when every entry of the list is an object with a name, "id" when
+// every entry has an id, and "" otherwise. Names and ids are strings.
+func listKey(list []interface{}) string {
+	for _, key := range []string{"name", "id"} {
+		named := len(list) > 0
+		for _, value := range list {
+			entry, ok := value.(map[string]interface{})
+			if id, isString := entry[key].(string); !ok || !isString || id == "" {
+				named = false
+				break
+			}
+		}
+		if named {
+			return key
+		}
+	}
+	return ""
+}
+
+// replace records source for the value at path and everything in it, forgetting where the
+// value it replaces came from.
+func (l *Layers) replace(path string, value interface{}, source string) {
+	for p := range l.Sources {
+		if p == path || strings.HasPrefix(p, path+".") || strings.HasPrefix(p, path+"[") {
+			delete(l.Sources, p)
+		}
+	}
+	l.record(path, value, source)
+}
+
+func (l *Layers) record(path string, value interface{}, source string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			l.record(path+"."+key, item, source)
+		}
+	case []interface{}:
+		for i, item := range v {
+			l.record(path+"["+strconv.Itoa(i)+"]", item, source)
+		}
+	default:
+		l.Sources[path] = source
+	}
+}
+
+// Setting is a value of a merged configuration and the layer it came from.
+type Setting struct {
+	Path   string
+	Value  interface{}
+	Source string
+}
+
+// Settings returns every value, objects' keys sorted and lists in order.
+func (l *Layers) Settings() []Setting {
+	var settings []Setting
+	var walk func(path string, value interface{})
+	walk = func(path string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(path+"."+key, v[key])
+			}
+		case []interface{}:
+			for i, item := range v {
+				walk(path+"["+strconv.Itoa(i)+"]", item)
+			}
+		default:
+			settings = append(settings, Setting{Path: path, Value: value, Source: l.Sources[path]})
+		}
+	}
+	walk("$", l.Values)
+	return settings
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadConfigLaysProfilesOverTheBase(t *testing.T) {
+	t.Setenv("SIMSTREAM_PLAYBACK__ABANDON_RATE", "0.5")
+	cfg, err := LoadConfig("../../configs/config.json", "black-friday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.NUsers != 8000 || cfg.Alpha != 60 {
+		t.Errorf("n-users %d and alpha %g, want the profile's 8000 and 60", cfg.NUsers, cfg.Alpha)
+	}
+	if cfg.Playback.AbandonRate != 0.5 {
+		t.Errorf("abandon rate %g, want 0.5 from the environment", cfg.Playback.AbandonRate)
+	}
+	if len(cfg.Regions) != 5 || cfg.Regions[0].Weight != 60 || cfg.Regions[0].Currency != "USD" {
+		t.Errorf("regions = %+v, want US reweighted and the rest kept", cfg.Regions)
+	}
+	campaigns := cfg.AdConfig.Campaigns
+	if len(campaigns) != 5 || campaigns[3].Bid != 0.006 || len(campaigns[3].Targeting.Tiers) != 1 || campaigns[4].Name != "black-friday-deals" {
+		t.Errorf("campaigns = %+v, want streaming-promo updated and black-friday-deals added", campaigns)
+	}
+}
+
+func TestLayersRecordSources(t *testing.T) {
+	layers := &Layers{Values: map[string]interface{}{}, Sources: map[string]string{}}
+	layers.merge(layers.Values, map[string]interface{}{
+		"alpha":       90.0,
+		"regions":     []interface{}{map[string]interface{}{"name": "US", "weight": 45.0}},
+		"transitions": []interface{}{map[string]interface{}{"p": 0.5}, map[string]interface{}{"p": 0.2}},
+	}, "$", "base")
+	layers.merge(layers.Values, map[string]interface{}{
+		"regions":     []interface{}{map[string]interface{}{"name": "GB", "weight": 15.0}},
+		"transitions": []interface{}{map[string]interface{}{"p": 0.9}},
+	}, "$", "profile")
+	if err := layers.applyEnv([]string{"SIMSTREAM_ALPHA=30", "SIMSTREAM_TAG=sale", "SIMSTREAM_PROFILE=ignored", "HOME=/root"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := layers.applyEnv([]string{"SIMSTREAM_ALPHA__X=1"}); err == nil || !strings.Contains(err.Error(), "not an object") {
+		t.Errorf("err = %v, want alpha reported as not an object", err)
+	}
+
+	want := map[string]struct {
+		value  interface{}
+		source string
+	}{
+		"$.alpha":             {30.0, "env SIMSTREAM_ALPHA"},
+		"$.regions[0].name":   {"US", "base"},
+		"$.regions[1].weight": {15.0, "profile"},
+		"$.tag":               {"sale", "env SIMSTREAM_TAG"},
+		"$.transitions[0].p":  {0.9, "profile"},
+	}
+	settings := layers.Settings()
+	if len(settings) != 7 {
+		t.Errorf("got %d settings, want 7: %+v", len(settings), settings)
+	}
+	for _, setting := range settings {
+		if w, ok := want[setting.Path]; ok && (setting.Value != w.value || setting.Source != w.source) {
+			t.Errorf("%s = %v from %q, want %v from %q", setting.Path, setting.Value, setting.Source, w.value, w.source)
+		}
+	}
+}
+
+func TestApplyViperLaysFlagsAndDefaults(t *testing.T) {
+	// Viper holds bound flags as their text, the way it reports float flags
+	v := viper.New()
+	v.SetDefault("start-time", "2024-04-18T00:00:00Z")
+	v.SetDefault("growth-rate", "0.01")
+	v.SetDefault("alpha", "0")
+	v.Set("n-users", "5")
+	changed := map[string]bool{"n-users": true}
+
+	layers := &Layers{Values: map[string]interface{}{}, Sources: map[string]string{}}
+	layers.merge(layers.Values, map[string]interface{}{"n-users": 100.0, "alpha": 90.0}, "$", "base")
+	layers.ApplyViper(v, func(key string) bool { return changed[key] })
+
+	want := map[string]struct {
+		value  interface{}
+		source string
+	}{
+		"$.n-users":     {5.0, "flag --n-users"},
+		"$.alpha":       {90.0, "base"},
+		"$.growth-rate": {0.01, "default"},
+		"$.start-time":  {"2024-04-18T00:00:00Z", "default"},
+	}
+	settings := layers.Settings()
+	if len(settings) != len(want) {
+		t.Fatalf("settings = %+v, want %d", settings, len(want))
+	}
+	for _, setting := range settings {
+		if w := want[setting.Path]; setting.Value != w.value || setting.Source != w.source {
+			t.Errorf("%s = %v (%T) from %q, want %v from %q", setting.Path, setting.Value, setting.Value, setting.Source, w.value, w.source)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError is a problem found in a configuration, located by the JSON path of the
+// offending value, or by the flag setting it for values that come from the command line.
+type ValidationError struct {
+	Path    string // e.g. $.transitions[12].p, or --end-time
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors lists every problem found in a configuration.
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (errs *ValidationErrors) add(path, format string, args ...interface{}) {
+	*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks that the configuration can be simulated, returning ValidationErrors
+// listing every problem found, or nil. It checks that:
+//   - the simulation ends after it starts,
+//   - the weights users are drawn with are not empty,
+//   - every auth and level users start with has new-session pages,
+//   - transitions have a known type and a probability between 0 and 1,
+//   - the outgoing probabilities of every state, and of every history it is reached
+//     after, add up to at most 1,
+//   - every state can be reached from the new-session pages, and
+//   - dwell times have a known distribution with usable parameters,
+//   - seeks during playback have a usable length, and
+//   - catalog premieres and licence windows are dated as 2006-01-02.
+func (cfg *Config) Validate() error {
+	var errs ValidationErrors
+	cfg.validateTimes(&errs)
+	cfg.validateWeights(&errs)
+	cfg.validateNewSessionPages(&errs)
+	cfg.validateTransitions(&errs)
+	cfg.validateDwell(&errs)
+	cfg.validatePlayback(&errs)
+	cfg.validateCatalog(&errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (cfg *Config) validateTimes(errs *ValidationErrors) {
+	if cfg.StartDate != "" && cfg.EndDate != "" {
+		start, err := time.Parse(time.RFC3339, cfg.StartDate)
+		if err != nil {
+			errs.add("$.start-date", "%q is not an RFC 3339 time", cfg.StartDate)
+		}
+		end, err2 := time.Parse(time.RFC3339, cfg.EndDate)
+		if err2 != nil {
+			errs.add("$.end-date", "%q is not an RFC 3339 time", cfg.EndDate)
+		}
+		if err == nil && err2 == nil && !end.After(start) {
+			errs.add("$.end-date", "%s is not after the start date %s", cfg.EndDate, cfg.StartDate)
+		}
+	}
+	if !cfg.StartTime.IsZero() && !cfg.EndTime.IsZero() && !cfg.EndTime.After(cfg.StartTime) {
+		errs.add("--end-time", "%s is not after the start time %s", cfg.EndTime.Format(time.RFC3339), cfg.StartTime.Format(time.RFC3339))
+	}
+}
+
+func (cfg *Config) validateWeights(errs *ValidationErrors) {
+	validatePreferences(errs, "$.auth-levels", cfg.AuthLevels, true)
+	validatePreferences(errs, "$.levels", cfg.Levels, true)
+	validatePreferences(errs, "$.genres", cfg.Genres, false)
+	regions := make([]Preference, len(cfg.Regions))
+	for i, region := range cfg.Regions {
+		regions[i] = Preference{Name: region.Name, Weight: region.Weight}
+	}
+	validatePreferences(errs, "$.regions", regions, false)
+
+	total := 0.0
+	for i, chance := range cfg.SubscriptionChances {
+		if chance.Chance < 0 {
+			errs.add(fmt.Sprintf("$.subscription-chances[%d].chance", i), "%g is negative", chance.Chance)
+		}
+		total += chance.Chance
+	}
+	if len(cfg.SubscriptionChances) > 0 && int(total*100) <= 0 {
+		errs.add("$.subscription-chances", "chances add up to %g, so no subscription can be drawn", total)
+	}
+}
+
+// validatePreferences checks that weights are not negative and, when there are any or
+// they are required, that they add up to more than zero.
+func validatePreferences(errs *ValidationErrors, path string, preferences []Preference, required bool) {
+	if len(preferences) == 0 {
+		if required {
+			errs.add(path, "must not be empty")
+		}
+		return
+	}
+	total := 0
+	for i, p := range preferences {
+		if p.Weight < 0 {
+			errs.add(fmt.Sprintf("%s[%d].weight", path, i), "%d is negative", p.Weight)
+			continue
+		}
+		total += p.Weight
+	}
+	if total <= 0 {
+		errs.add(path, "weights add up to %d, so none can be drawn", total)
+	}
+}
+
+// startingLevels returns the levels users with the given auth can start a session with.
+// Guests hold the free subscription; other users hold any subscription they can be drawn
+// with. A subscription tier with a level fixes the level, otherwise it is drawn from levels.
+func (cfg *Config) startingLevels(auth string) []string {
+	subscriptions := []string{"free"}
+	if auth != "Guest" && len(cfg.SubscriptionChances) > 0 {
+		subscriptions = subscriptions[:0]
+		for _, chance := range cfg.SubscriptionChances {
+			if chance.Chance > 0 {
+				subscriptions = append(subscriptions, chance.Type)
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	var levels []string
+	add := func(level string) {
+		if !seen[level] {
+			seen[level] = true
+			levels = append(levels, level)
+		}
+	}
+	for _, subscription := range subscriptions {
+		if tier, ok := cfg.Tier(subscription); ok && tier.Level != "" {
+			add(tier.Level)
+			continue
+		}
+		for _, level := range cfg.Levels {
+			if level.Weight > 0 {
+				add(level.Name)
+			}
+		}
+	}
+	return levels
+}
+
+// LevelShares returns the share of users with the given auth that start a session with each
+// level, drawn the way startingLevels describes: by subscription chance, then by the level
+// weights for subscriptions whose tier does not fix the level.
+func (cfg *Config) LevelShares(auth string) map[string]float64 {
+	chances := map[string]float64{"free": 1}
+	if auth != "Guest" && len(cfg.SubscriptionChances) > 0 {
+		chances = make(map[string]float64)
+		for _, chance := range cfg.SubscriptionChances {
+			if chance.Chance > 0 {
+				chances[chance.Type] += chance.Chance
+			}
+		}
+	}
+	levelTotal := 0
+	for _, level := range cfg.Levels {
+		if level.Weight > 0 {
+			levelTotal += level.Weight
+		}
+	}
+	shares := make(map[string]float64)
+	total := 0.0
+	for subscription, chance := range chances {
+		total += chance
+		if tier, ok := cfg.Tier(subscription); ok && tier.Level != "" {
+			shares[tier.Level] += chance
+			continue
+		}
+		for _, level := range cfg.Levels {
+			if level.Weight > 0 {
+				shares[level.Name] += chance * float64(level.Weight) / float64(levelTotal)
+			}
+		}
+	}
+	for level := range shares {
+		shares[level] /= total
+	}
+	return shares
+}
+
+func (cfg *Config) validateNewSessionPages(errs *ValidationErrors) {
+	weights := make(map[[2]string]int)
+	for i, page := range cfg.NewSessionPages {
+		if page.Weight < 0 {
+			errs.add(fmt.Sprintf("$.new-session[%d].weight", i), "%d is negative", page.Weight)
+			continue
+		}
+		weights[[2]string{page.Auth, page.Level}] += page.Weight
+	}
+	for _, auth := range cfg.AuthLevels {
+		if auth.Weight <= 0 {
+			continue
+		}
+		for _, level := range cfg.startingLevels(auth.Name) {
+			if weights[[2]string{auth.Name, level}] <= 0 {
+				errs.add("$.new-session", "no page with a weight for auth %q and level %q, which users start sessions with", auth.Name, level)
+			}
+		}
+	}
+}
+
+// transitionSource is a state and the pages viewed before it, which the probabilities of
+// the transitions from it add up over.
+type transitionSource struct {
+	state   StateConfig
+	history string
+}
+
+func (s transitionSource) String() string {
+	if s.history == "" {
+		return s.state.String()
+	}
+	return s.state.String() + " after " + s.history
+}
+
+func (cfg *Config) validateTransitions(errs *ValidationErrors) {
+	totals := make(map[transitionSource]float64)
+	last := make(map[transitionSource]int)
+	outgoing := make(map[StateConfig][]StateConfig)
+	for i, trans := range cfg.Transitions {
+		path := fmt.Sprintf("$.transitions[%d]", i)
+		switch trans.Type {
+		case "", "lateral", "upgrade", "downgrade":
+		default:
+			errs.add(path+".type", "unknown transition type %q, want lateral, upgrade or downgrade", trans.Type)
+		}
+		if trans.P < 0 || trans.P > 1 {
+			errs.add(path+".p", "probability %g is not between 0 and 1", trans.P)
+		}
+		for j, override := range trans.Overrides {
+			validateTransitionOverride(errs, fmt.Sprintf("%s.overrides[%d]", path, j), override)
+		}
+		for j, page := range trans.History {
+			if page == "" {
+				errs.add(fmt.Sprintf("%s.history[%d]", path, j), "must not be empty")
+			}
+		}
+		source := transitionSource{trans.Source, strings.Join(trans.History, " > ")}
+		totals[source] += trans.P
+		last[source] = i
+		outgoing[trans.Source] = append(outgoing[trans.Source], trans.Dest)
+	}
+	sources := make([]transitionSource, 0, len(totals))
+	for source := range totals {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool { return last[sources[i]] < last[sources[j]] })
+	for _, source := range sources {
+		if total := totals[source]; total > 1+1e-9 {
+			errs.add(fmt.Sprintf("$.transitions[%d].p", last[source]), "outgoing probabilities of %s add up to %g, more than 1", source, total)
+		}
+	}
+
+	reached := make(map[StateConfig]bool)
+	var queue []StateConfig
+	for _, page := range cfg.NewSessionPages {
+		state := StateConfig{Page: page.Page, Method: page.Method, Status: page.Status, Auth: page.Auth, Level: page.Level}
+		if !reached[state] {
+			reached[state] = true
+			queue = append(queue, state)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for _, dest := range outgoing[state] {
+			if !reached[dest] {
+				reached[dest] = true
+				queue = append(queue, dest)
+			}
+		}
+	}
+	reported := make(map[StateConfig]bool)
+	for i, trans := range cfg.Transitions {
+		for _, end := range []struct {
+			field string
+			state StateConfig
+		}{{"source", trans.Source}, {"dest", trans.Dest}} {
+			if !reached[end.state] && !reported[end.state] {
+				reported[end.state] = true
+				errs.add(fmt.Sprintf("$.transitions[%d].%s", i, end.field), "%s cannot be reached from the new-session pages", end.state)
+			}
+		}
+	}
+}
+
+// validateTransitionOverride checks the probability and conditions of an override. The
+// outgoing probabilities of a state are not checked against overrides, as the simulator
+// scales them down when the overrides that apply add up to more than 1.
+func validateTransitionOverride(errs *ValidationErrors, path string, override TransitionOverride) {
+	if override.P < 0 || override.P > 1 {
+		errs.add(path+".p", "probability %g is not between 0 and 1", override.P)
+	}
+	when := override.When
+	for i, hour := range when.Hours {
+		if hour < 0 || hour > 23 {
+			errs.add(fmt.Sprintf("%s.when.hours[%d]", path, i), "%d is not an hour between 0 and 23", hour)
+		}
+	}
+	for i, day := range when.Weekdays {
+		if _, ok := ParseWeekday(day); !ok {
+			errs.add(fmt.Sprintf("%s.when.weekdays[%d]", path, i), "%q is not a weekday", day)
+		}
+	}
+	if when.MinItem < 0 {
+		errs.add(path+".when.min-item", "%d is negative", when.MinItem)
+	}
+	if when.MaxItem < 0 {
+		errs.add(path+".when.max-item", "%d is negative", when.MaxItem)
+	} else if when.MaxItem > 0 && when.MaxItem < when.MinItem {
+		errs.add(path+".when.max-item", "%d is below the min-item %d", when.MaxItem, when.MinItem)
+	}
+}
+
+func (cfg *Config) validateDwell(errs *ValidationErrors) {
+	for i, d := range cfg.Dwell {
+		path := fmt.Sprintf("$.dwell[%d]", i)
+		if status := strings.ToLower(d.Status); status != "" {
+			digits := strings.TrimSuffix(status, "xx")
+			if _, err := strconv.Atoi(digits); err != nil {
+				errs.add(path+".status", "%q is neither a status code nor a class such as 3xx", d.Status)
+			}
+		}
+		if d.Mean < 0 {
+			errs.add(path+".mean", "%g is negative", d.Mean)
+		}
+		switch d.Distribution {
+		case "", "exponential", "fixed":
+		case "log-normal":
+			if d.StdDev <= 0 {
+				errs.add(path+".stddev", "a log-normal dwell needs a positive standard deviation")
+			}
+		case "gamma":
+			if d.Shape <= 0 {
+				errs.add(path+".shape", "a gamma dwell needs a positive shape")
+			}
+		case "empirical":
+			if len(d.Histogram) == 0 {
+				errs.add(path+".histogram", "an empirical dwell needs a histogram")
+			}
+			lower, total := 0.0, 0.0
+			for j, bin := range d.Histogram {
+				if bin.Upper <= lower {
+					errs.add(fmt.Sprintf("%s.histogram[%d].upper", path, j), "%g is not above the previous bin's %g", bin.Upper, lower)
+				}
+				if bin.Weight < 0 {
+					errs.add(fmt.Sprintf("%s.histogram[%d].weight", path, j), "%g is negative", bin.Weight)
+				}
+				lower = bin.Upper
+				total += bin.Weight
+			}
+			if len(d.Histogram) > 0 && total <= 0 {
+				errs.add(path+".histogram", "weights add up to %g, so no dwell can be drawn", total)
+			}
+		default:
+			errs.add(path+".distribution", "unknown distribution %q, want exponential, log-normal, gamma, fixed or empirical", d.Distribution)
+		}
+	}
+}
+
+func (cfg *Config) validatePlayback(errs *ValidationErrors) {
+	if cfg.Playback.MaxSeekSeconds < 0 {
+		errs.add("$.playback.max-seek-seconds", "%d is negative", cfg.Playback.MaxSeekSeconds)
+	}
+}
+
+func (cfg *Config) validateCatalog(errs *ValidationErrors) {
+	for i, premiere := range cfg.Catalog.Premieres {
+		validateDate(errs, fmt.Sprintf("$.catalog.premieres[%d].date", i), premiere.Date)
+	}
+	for i, license := range cfg.Catalog.Licenses {
+		validateDate(errs, fmt.Sprintf("$.catalog.licenses[%d].from", i), license.From)
+		validateDate(errs, fmt.Sprintf("$.catalog.licenses[%d].until", i), license.Until)
+	}
+}
+
+// validateDate reports a date that is set but not given as 2006-01-02.
+func validateDate(errs *ValidationErrors, path, date string) {
+	if date == "" {
+		return
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		errs.add(path, "%q is not a date as 2006-01-02", date)
+	}
+}
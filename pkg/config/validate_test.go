@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestValidateReportsProblemsWithPaths(t *testing.T) {
+	home := StateConfig{Page: "Home", Method: "GET", Status: 200, Auth: "Logged In", Level: "free"}
+	about := StateConfig{Page: "About", Method: "GET", Status: 200, Auth: "Logged In", Level: "free"}
+	orphan := StateConfig{Page: "Help", Method: "GET", Status: 200, Auth: "Logged In", Level: "free"}
+	start := time.Date(2024, time.April, 18, 0, 0, 0, 0, time.UTC)
+	cfg := &Config{
+		StartTime:       start,
+		EndTime:         start.Add(-time.Hour),
+		AuthLevels:      []Preference{{Name: "Logged In", Weight: 1}},
+		Levels:          []Preference{{Name: "free", Weight: 1}, {Name: "paid", Weight: 0}},
+		Regions:         []Region{{Name: "US", Weight: 0}},
+		NewSessionPages: []SessionPage{{Page: "Home", Method: "GET", Status: 200, Auth: "Logged In", Level: "free", Weight: 1}},
+		Transitions: []Transition{
+			{Source: home, Dest: about, P: 0.7, Overrides: []TransitionOverride{
+				{When: TransitionCondition{Hours: []int{24}, Weekdays: []string{"Caturday"}}, P: 0.2},
+				{When: TransitionCondition{MinItem: 5, MaxItem: 3}, P: 1.5},
+			}},
+			{Source: home, Dest: home, P: 0.5},
+			{Source: orphan, Dest: home, P: 0.5, Type: "sideways"},
+			{Source: home, Dest: about, History: []string{"About", ""}, P: 0.9},
+		},
+		Dwell: []DwellConfig{
+			{Page: "Help", Distribution: "gamma"},
+			{Status: "4x", Distribution: "empirical", Histogram: []DwellBin{{Upper: 10, Weight: 1}, {Upper: 5, Weight: 1}}},
+		},
+		Playback: PlaybackConfig{MaxSeekSeconds: -30},
+		Catalog: CatalogConfig{
+			Premieres: []Premiere{{ID: "p1", Date: "2024-05-01"}, {ID: "p2", Date: "May 1st"}},
+			Licenses:  []License{{Titles: []string{"p1"}, From: "2024-05-01", Until: "2024-13-01"}},
+		},
+	}
+
+	var errs ValidationErrors
+	if !errors.As(cfg.Validate(), &errs) {
+		t.Fatal("invalid config passed validation")
+	}
+	want := []string{"--end-time", "$.regions",
+		"$.transitions[0].overrides[0].when.hours[0]", "$.transitions[0].overrides[0].when.weekdays[0]",
+		"$.transitions[0].overrides[1].p", "$.transitions[0].overrides[1].when.max-item",
+		"$.transitions[2].type", "$.transitions[3].history[1]", "$.transitions[1].p", "$.transitions[2].source",
+		"$.dwell[0].shape", "$.dwell[1].status", "$.dwell[1].histogram[1].upper",
+		"$.playback.max-seek-seconds", "$.catalog.premieres[1].date", "$.catalog.licenses[0].until"}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d problems, want %d:\n%v", len(errs), len(want), errs)
+	}
+	for i, path := range want {
+		if errs[i].Path != path {
+			t.Errorf("problem %d at %s, want %s: %v", i, errs[i].Path, path, errs[i])
+		}
+	}
+
+	cfg.EndTime = start.Add(time.Hour)
+	cfg.Regions = nil
+	cfg.Transitions = cfg.Transitions[:1]
+	cfg.Transitions[0].Overrides = []TransitionOverride{{When: TransitionCondition{Hours: []int{0, 23}, Weekdays: []string{"saturday", "Sun"}, MinItem: 2}, P: 0.2}}
+	cfg.Dwell = []DwellConfig{{Status: "3xx", Distribution: "fixed", Mean: 1}}
+	cfg.Playback.MaxSeekSeconds = 0
+	cfg.Catalog.Premieres = cfg.Catalog.Premieres[:1]
+	cfg.Catalog.Licenses[0].Until = "2024-12-01"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("valid config failed validation: %v", err)
+	}
+}
+
+func TestLevelSharesFollowSubscriptionsAndTiers(t *testing.T) {
+	cfg := &Config{
+		Levels:              []Preference{{Name: "free", Weight: 3}, {Name: "paid", Weight: 1}},
+		SubscriptionChances: []SubscriptionChance{{Type: "free", Chance: 0.6}, {Type: "premium", Chance: 0.2}, {Type: "legacy", Chance: 0.2}},
+		SubscriptionTiers:   []SubscriptionTier{{Name: "free", Level: "free"}, {Name: "premium", Level: "paid"}},
+	}
+	tests := []struct {
+		auth string
+		want map[string]float64
+	}{
+		// legacy has no tier, so its users are split 3:1 by the level weights
+		{"Logged In", map[string]float64{"free": 0.6 + 0.15, "paid": 0.2 + 0.05}},
+		{"Guest", map[string]float64{"free": 1}},
+	}
+	for _, tt := range tests {
+		got := cfg.LevelShares(tt.auth)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: shares %v, want %v", tt.auth, got, tt.want)
+			continue
+		}
+		for level, share := range tt.want {
+			if math.Abs(got[level]-share) > 1e-9 {
+				t.Errorf("%s: share of %s = %g, want %g", tt.auth, level, got[level], share)
+			}
+		}
+	}
+}
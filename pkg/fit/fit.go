@@ -0,0 +1,332 @@
+// Package fit estimates simulator settings from clickstream logs, so simulated sessions
+// follow the paths, start pages and pacing of real ones.
+package fit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// Event is the part of a page view event that fitting reads. It has the shape of the
+// simulator's page view events.
+type Event struct {
+	Timestamp        int64  `json:"ts"` // Unix seconds
+	SessionID        int64  `json:"sessionId"`
+	UserID           int64  `json:"userId"`
+	Page             string `json:"page"`
+	Auth             string `json:"auth"`
+	Level            string `json:"level"`
+	Method           string `json:"method"`
+	Status           int    `json:"status"`
+	ItemInSession    int    `json:"itemInSession"`
+	SubscriptionType string `json:"subscriptionType"`
+}
+
+// level returns the event's level, from its subscription when the log has no level.
+func (e Event) level() string {
+	if e.Level != "" {
+		return e.Level
+	}
+	if e.SubscriptionType == "" || strings.EqualFold(e.SubscriptionType, "free") {
+		return "free"
+	}
+	return "paid"
+}
+
+func (e Event) state() config.StateConfig {
+	return config.StateConfig{Page: e.Page, Method: e.Method, Status: e.Status, Auth: e.Auth, Level: e.level()}
+}
+
+// Result holds the settings estimated from a log.
+type Result struct {
+	Alpha               float64 // mean seconds between page views in a session, see Fit
+	Beta                float64 // mean seconds between sessions beyond the session gap
+	NewSessionPages     []config.SessionPage
+	Transitions         []config.Transition
+	AuthLevels          []config.Preference // auths users are first seen with
+	Levels              []config.Preference // levels users are first seen with
+	SubscriptionChances []config.SubscriptionChance
+	TierLevels          map[string]string // level each subscription is most often seen with
+	Start, End          time.Time
+	Users               int
+	Sessions            int
+	Events              int
+}
+
+// probabilityPrecision is the number of decimals fitted probabilities are rounded down to.
+// Rounding down keeps the outgoing probabilities of a state at most 1.
+const probabilityPrecision = 1e6
+
+// Fit estimates the session state machine and pacing from page view events, read as
+// JSON objects separated by newlines or nothing at all. Events are grouped into sessions
+// by user and session ID and ordered by time.
+//
+// Transition probabilities are the share of page views of a state that the next page view
+// of the session follows from; the rest is the chance the session ends there. Alpha is the
+// mean gap between page views, leaving out gaps after redirects, which the simulator leaves
+// after a second, and gaps before content pages, whose timing follows playback. Beta is the
+// mean gap between a user's sessions less sessionGap, the fixed part of the gap the
+// simulator adds.
+func Fit(r io.Reader, sessionGap float64) (*Result, error) {
+	sessions := make(map[[2]int64][]Event)
+	var order [][2]int64
+	firstSeen := make(map[int64]Event)
+	result := &Result{TierLevels: make(map[string]string)}
+
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var e Event
+		if err := dec.Decode(&e); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("event %d: %w", n, err)
+		}
+		if e.Page == "" || e.Timestamp == 0 {
+			return nil, fmt.Errorf("event %d: no page or ts", n)
+		}
+		key := [2]int64{e.UserID, e.SessionID}
+		if _, ok := sessions[key]; !ok {
+			order = append(order, key)
+		}
+		sessions[key] = append(sessions[key], e)
+		if first, ok := firstSeen[e.UserID]; !ok || e.Timestamp < first.Timestamp {
+			firstSeen[e.UserID] = e
+		}
+		t := time.Unix(e.Timestamp, 0).UTC()
+		if result.Start.IsZero() || t.Before(result.Start) {
+			result.Start = t
+		}
+		if t.After(result.End) {
+			result.End = t
+		}
+		result.Events++
+	}
+	if result.Events == 0 {
+		return nil, errors.New("no events")
+	}
+	result.Users = len(firstSeen)
+	result.Sessions = len(sessions)
+
+	states := newStateIndex()
+	views := make(map[config.StateConfig]int)
+	starts := make(map[config.StateConfig]int)
+	moves := make(map[[2]config.StateConfig]int)
+	var alphaSum float64
+	var alphaCount int
+	userSessions := make(map[int64][]sessionSpan)
+	for _, key := range order {
+		events := sessions[key]
+		sort.SliceStable(events, func(i, j int) bool {
+			if events[i].Timestamp != events[j].Timestamp {
+				return events[i].Timestamp < events[j].Timestamp
+			}
+			return events[i].ItemInSession < events[j].ItemInSession
+		})
+		start := states.add(events[0].state())
+		starts[start]++
+		for i, e := range events {
+			state := states.add(e.state())
+			views[state]++
+			if i == 0 {
+				continue
+			}
+			moves[[2]config.StateConfig{events[i-1].state(), state}]++
+			if !redirect(events[i-1].Status) && e.Page != "NextVideo" && e.Page != "NextSong" {
+				alphaSum += float64(e.Timestamp - events[i-1].Timestamp)
+				alphaCount++
+			}
+		}
+		userSessions[key[0]] = append(userSessions[key[0]], sessionSpan{events[0].Timestamp, events[len(events)-1].Timestamp})
+	}
+	if alphaCount > 0 {
+		result.Alpha = alphaSum / float64(alphaCount)
+	}
+	result.Beta = fitBeta(userSessions, sessionGap)
+
+	for _, state := range states.order {
+		if starts[state] > 0 {
+			result.NewSessionPages = append(result.NewSessionPages, config.SessionPage{
+				Page: state.Page, Method: state.Method, Status: state.Status, Auth: state.Auth, Level: state.Level, Weight: starts[state],
+			})
+		}
+	}
+	for _, source := range states.order {
+		for _, dest := range states.order {
+			count := moves[[2]config.StateConfig{source, dest}]
+			if count == 0 {
+				continue
+			}
+			p := math.Floor(float64(count)/float64(views[source])*probabilityPrecision) / probabilityPrecision
+			if p == 0 {
+				continue
+			}
+			result.Transitions = append(result.Transitions, config.Transition{Source: source, Dest: dest, Type: transitionType(source, dest), P: p})
+		}
+	}
+
+	auths, levels := newCounter(), newCounter()
+	subscriptions := newCounter()
+	tierLevels := make(map[string]*counter)
+	users := make([]int64, 0, len(firstSeen))
+	for user := range firstSeen {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	for _, user := range users {
+		e := firstSeen[user]
+		auths.add(e.Auth)
+		levels.add(e.level())
+		if e.SubscriptionType != "" {
+			subscription := strings.ToLower(e.SubscriptionType)
+			subscriptions.add(subscription)
+			if tierLevels[subscription] == nil {
+				tierLevels[subscription] = newCounter()
+			}
+			tierLevels[subscription].add(e.level())
+		}
+	}
+	result.AuthLevels = auths.preferences()
+	result.Levels = levels.preferences()
+	for _, p := range subscriptions.preferences() {
+		result.SubscriptionChances = append(result.SubscriptionChances, config.SubscriptionChance{
+			Type:   p.Name,
+			Chance: math.Round(float64(p.Weight)/float64(len(users))*1000) / 1000,
+		})
+		result.TierLevels[p.Name] = tierLevels[p.Name].preferences()[0].Name
+	}
+	return result, nil
+}
+
+type sessionSpan struct {
+	first, last int64
+}
+
+// fitBeta returns the mean gap between the end of a user's session and the start of their
+// next, less the fixed session gap.
+func fitBeta(userSessions map[int64][]sessionSpan, sessionGap float64) float64 {
+	var sum float64
+	var count int
+	for _, spans := range userSessions {
+		sort.Slice(spans, func(i, j int) bool { return spans[i].first < spans[j].first })
+		for i := 1; i < len(spans); i++ {
+			sum += float64(spans[i].first-spans[i-1].last) - sessionGap
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return math.Max(sum/float64(count), 1)
+}
+
+func redirect(status int) bool {
+	return status >= 300 && status <= 399
+}
+
+// authRank orders auths from the least to the most privileged.
+var authRank = map[string]int{"Cancelled": 0, "Logged Out": 1, "Guest": 1, "Logged In": 2}
+
+// transitionType classifies a transition: moving to a more privileged auth or off the free
+// level is an upgrade, the reverse a downgrade, and staying on the same auth and level lateral.
+func transitionType(source, dest config.StateConfig) string {
+	if source.Auth != dest.Auth {
+		if authRank[dest.Auth] > authRank[source.Auth] {
+			return "upgrade"
+		}
+		return "downgrade"
+	}
+	if source.Level != dest.Level {
+		if source.Level == "free" {
+			return "upgrade"
+		}
+		return "downgrade"
+	}
+	return ""
+}
+
+// stateIndex keeps states in the order they are first seen, so fitted configs are stable.
+type stateIndex struct {
+	seen  map[config.StateConfig]bool
+	order []config.StateConfig
+}
+
+func newStateIndex() *stateIndex {
+	return &stateIndex{seen: make(map[config.StateConfig]bool)}
+}
+
+func (idx *stateIndex) add(state config.StateConfig) config.StateConfig {
+	if !idx.seen[state] {
+		idx.seen[state] = true
+		idx.order = append(idx.order, state)
+	}
+	return state
+}
+
+// counter counts names in the order they are first seen.
+type counter struct {
+	counts map[string]int
+	names  []string
+}
+
+func newCounter() *counter {
+	return &counter{counts: make(map[string]int)}
+}
+
+func (c *counter) add(name string) {
+	if _, ok := c.counts[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.counts[name]++
+}
+
+// preferences returns the counts as weights, the most common first.
+func (c *counter) preferences() []config.Preference {
+	prefs := make([]config.Preference, len(c.names))
+	for i, name := range c.names {
+		prefs[i] = config.Preference{Name: name, Weight: c.counts[name]}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].Weight > prefs[j].Weight })
+	return prefs
+}
+
+// Apply writes the fitted settings into a config, given as its decoded JSON, keeping the
+// settings that fitting does not estimate. The auths, levels and subscriptions users start
+// with are only written when the config does not have them, as they describe the user base
+// rather than sessions.
+func (r *Result) Apply(cfg map[string]interface{}) {
+	cfg["alpha"] = math.Round(r.Alpha*100) / 100
+	cfg["beta"] = math.Round(r.Beta*100) / 100
+	cfg["new-session"] = r.NewSessionPages
+	cfg["transitions"] = r.Transitions
+	if _, ok := cfg["auth-levels"]; !ok {
+		cfg["auth-levels"] = r.AuthLevels
+	}
+	if _, ok := cfg["levels"]; !ok {
+		cfg["levels"] = r.Levels
+	}
+	if _, ok := cfg["subscription-chances"]; !ok && len(r.SubscriptionChances) > 0 {
+		cfg["subscription-chances"] = r.SubscriptionChances
+		if _, ok := cfg["subscription-tiers"]; !ok {
+			tiers := make([]map[string]string, 0, len(r.SubscriptionChances))
+			for _, chance := range r.SubscriptionChances {
+				tiers = append(tiers, map[string]string{"name": chance.Type, "level": r.TierLevels[chance.Type]})
+			}
+			cfg["subscription-tiers"] = tiers
+		}
+	}
+	if _, ok := cfg["n-users"]; !ok {
+		cfg["n-users"] = r.Users
+	}
+	if _, ok := cfg["start-date"]; !ok {
+		cfg["start-date"] = r.Start.Format(time.RFC3339)
+		cfg["end-date"] = r.End.Format(time.RFC3339)
+	}
+}
@@ -0,0 +1,57 @@
+package fit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+const events = `{"ts":1000,"sessionId":1,"userId":1,"page":"Home","auth":"Logged In","level":"free","method":"GET","status":200}
+{"ts":1060,"sessionId":1,"userId":1,"page":"Upgrade","auth":"Logged In","level":"free","method":"GET","status":200}
+{"ts":1061,"sessionId":1,"userId":1,"page":"Submit Upgrade","auth":"Logged In","level":"free","method":"PUT","status":307}
+{"ts":1180,"sessionId":1,"userId":1,"page":"Home","auth":"Logged In","level":"paid","method":"GET","status":200}
+{"ts":5180,"sessionId":2,"userId":1,"page":"Home","auth":"Logged In","level":"paid","method":"GET","status":200}
+{"ts":2000,"sessionId":3,"userId":2,"page":"Home","auth":"Logged In","subscriptionType":"free","method":"GET","status":200}
+{"ts":2030,"sessionId":3,"userId":2,"page":"Help","auth":"Logged In","subscriptionType":"free","method":"GET","status":200}
+`
+
+func TestFitEstimatesSessions(t *testing.T) {
+	result, err := Fit(strings.NewReader(events), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Users != 2 || result.Sessions != 3 || result.Events != 7 {
+		t.Errorf("read %d users, %d sessions and %d events, want 2, 3 and 7", result.Users, result.Sessions, result.Events)
+	}
+	// gaps before Upgrade, Submit Upgrade and Help; the gap after the redirect is left out
+	if result.Alpha != (60.0+1+30)/3 {
+		t.Errorf("alpha = %g, want the mean gap between page views that do not follow redirects", result.Alpha)
+	}
+	if result.Beta != 4000 {
+		t.Errorf("beta = %g, want the 4000s between user 1's sessions", result.Beta)
+	}
+
+	home := config.StateConfig{Page: "Home", Method: "GET", Status: 200, Auth: "Logged In", Level: "free"}
+	if len(result.NewSessionPages) != 2 || result.NewSessionPages[0].Weight != 2 || result.NewSessionPages[0].Page != "Home" {
+		t.Errorf("new-session pages = %+v, want free Home twice and paid Home once", result.NewSessionPages)
+	}
+	found := map[string]config.Transition{}
+	for _, trans := range result.Transitions {
+		if trans.Source == home {
+			found[trans.Dest.Page] = trans
+		}
+		if trans.Source.Page == "Submit Upgrade" && trans.Type != "upgrade" {
+			t.Errorf("transition into the paid level is %q, want upgrade", trans.Type)
+		}
+	}
+	if found["Upgrade"].P != 0.5 || found["Help"].P != 0.5 {
+		t.Errorf("transitions from free Home = %+v, want Upgrade and Help at 0.5 each", found)
+	}
+}
+
+func TestFitReportsBadEvents(t *testing.T) {
+	if _, err := Fit(strings.NewReader(`{"ts":1,"page":"Home"}`+"\n"+`{"ts":`), 0); err == nil || !strings.Contains(err.Error(), "event 2") {
+		t.Errorf("err = %v, want the broken second event reported", err)
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// AdHistory records the ads served to a user so that frequency caps hold across sessions.
+type AdHistory struct {
+	total      map[string]int // impressions per campaign over the whole simulation
+	day        string         // simulated day the daily counters belong to
+	daily      map[string]int // impressions per campaign on the current day
+	dailyTotal int            // impressions across all campaigns on the current day
+}
+
+func NewAdHistory() *AdHistory {
+	return &AdHistory{
+		total: make(map[string]int),
+		daily: make(map[string]int),
+	}
+}
+
+// dayKey buckets a simulated timestamp into a calendar day.
+func dayKey(at time.Time) string {
+	return at.UTC().Format("2006-01-02")
+}
+
+// rollDay resets the daily counters once the simulated clock moves into a new day.
+func (h *AdHistory) rollDay(at time.Time) {
+	if key := dayKey(at); key != h.day {
+		h.day = key
+		h.daily = make(map[string]int)
+		h.dailyTotal = 0
+	}
+}
+
+// CanServe reports whether the campaign may be shown at the given time without breaking
+// its lifetime or daily cap, or the user's overall daily ad limit.
+func (h *AdHistory) CanServe(campaign config.AdCampaign, at time.Time, maxPerDay int) bool {
+	h.rollDay(at)
+	if maxPerDay > 0 && h.dailyTotal >= maxPerDay {
+		return false
+	}
+	if campaign.FrequencyCap > 0 && h.total[campaign.Name] >= campaign.FrequencyCap {
+		return false
+	}
+	if campaign.DailyCap > 0 && h.daily[campaign.Name] >= campaign.DailyCap {
+		return false
+	}
+	return true
+}
+
+// Record counts an impression of the campaign at the given time.
+func (h *AdHistory) Record(campaign string, at time.Time) {
+	h.rollDay(at)
+	h.total[campaign]++
+	h.daily[campaign]++
+	h.dailyTotal++
+}
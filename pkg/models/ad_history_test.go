@@ -0,0 +1,59 @@
+package models
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func TestAdHistoryEnforcesCaps(t *testing.T) {
+	day := time.Date(2024, time.April, 18, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		campaign  config.AdCampaign
+		maxPerDay int
+		served    []time.Time // impressions already recorded
+		at        time.Time
+		want      bool
+	}{
+		{"no caps", config.AdCampaign{Name: "a"}, 0, []time.Time{day, day, day}, day, true},
+		{"lifetime cap reached", config.AdCampaign{Name: "a", FrequencyCap: 2}, 0, []time.Time{day, day.AddDate(0, 0, -3)}, day, false},
+		{"daily cap reached", config.AdCampaign{Name: "a", DailyCap: 2}, 0, []time.Time{day, day.Add(time.Hour)}, day.Add(2 * time.Hour), false},
+		{"daily cap resets the next day", config.AdCampaign{Name: "a", DailyCap: 2}, 0, []time.Time{day, day.Add(time.Hour)}, day.AddDate(0, 0, 1), true},
+		{"user daily limit reached", config.AdCampaign{Name: "a"}, 2, []time.Time{day, day}, day, false},
+	}
+	for _, tt := range tests {
+		h := NewAdHistory()
+		for _, at := range tt.served {
+			h.Record(tt.campaign.Name, at)
+		}
+		if got := h.CanServe(tt.campaign, tt.at, tt.maxPerDay); got != tt.want {
+			t.Errorf("%s: CanServe = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAdFatigueGrowsWithAdsShown(t *testing.T) {
+	cfg := &config.Config{AdConfig: config.AdConfig{FatigueFactor: 0.1}}
+	abandonRate := func(ads int) float64 {
+		s := &Session{Rng: rand.New(rand.NewSource(1)), Config: cfg, AdsInSession: ads}
+		abandoned := 0
+		for i := 0; i < 10000; i++ {
+			if s.abandonsForAdFatigue() {
+				abandoned++
+			}
+		}
+		return float64(abandoned) / 10000
+	}
+	if rate := abandonRate(0); rate != 0 {
+		t.Errorf("abandoned %.3f of sessions before any ad", rate)
+	}
+	if rate := abandonRate(3); rate < 0.27 || rate > 0.33 {
+		t.Errorf("abandoned %.3f of sessions after 3 ads, want about 0.3", rate)
+	}
+	if rate := abandonRate(20); rate != 1 {
+		t.Errorf("abandoned %.3f of sessions after 20 ads, want all of them", rate)
+	}
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// AdRequest describes an ad slot offered to the ad server.
+type AdRequest struct {
+	Time   time.Time
+	Genres []string // genres of the content the slot is attached to
+	Tier   SubscriptionType
+	Device string
+}
+
+// AdDecision is the outcome of the auction for a single ad slot.
+type AdDecision struct {
+	RequestID    string
+	Time         time.Time
+	Filled       bool
+	Campaign     string
+	Bid          float64 // the winning campaign's bid
+	WinPrice     float64 // the price the winner pays: second highest bid or the floor
+	Bidders      int
+	NoFillReason string
+}
+
+// AdServer runs a second-price auction among the campaigns eligible for each ad slot
+// and keeps track of campaign spend so budgets are paced over the simulation window.
+type AdServer struct {
+	campaigns  []config.AdCampaign
+	floorPrice float64
+	start      time.Time
+	end        time.Time
+	spend      map[string]float64
+	requests   int64
+	mu         sync.Mutex
+}
+
+func NewAdServer(cfg *config.Config) *AdServer {
+	return &AdServer{
+		campaigns:  cfg.AdConfig.Campaigns,
+		floorPrice: cfg.AdConfig.FloorPrice,
+		start:      cfg.StartTime,
+		end:        cfg.EndTime,
+		spend:      make(map[string]float64),
+	}
+}
+
+// Decide runs the auction for an ad slot. Campaigns are eligible when they match the
+// request's targeting, bid at least the floor price, are within their paced budget and
+// pass the caller's frequency cap check.
+func (a *AdServer) Decide(req AdRequest, canServe func(config.AdCampaign) bool) AdDecision {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.requests++
+	decision := AdDecision{
+		RequestID: fmt.Sprintf("adreq-%d", a.requests),
+		Time:      req.Time,
+	}
+
+	bidders := make([]config.AdCampaign, 0, len(a.campaigns))
+	for _, c := range a.campaigns {
+		if c.Bid < a.floorPrice || !matchesTargeting(c.Targeting, req) || !a.withinPacing(c, req.Time) {
+			continue
+		}
+		if canServe != nil && !canServe(c) {
+			continue
+		}
+		bidders = append(bidders, c)
+	}
+	decision.Bidders = len(bidders)
+	if len(bidders) == 0 {
+		decision.NoFillReason = a.noFillReason()
+		return decision
+	}
+
+	sort.SliceStable(bidders, func(i, j int) bool {
+		return bidders[i].Bid > bidders[j].Bid
+	})
+	winner := bidders[0]
+	price := a.floorPrice
+	if len(bidders) > 1 && bidders[1].Bid > price {
+		price = bidders[1].Bid
+	}
+	a.spend[winner.Name] += price
+
+	decision.Filled = true
+	decision.Campaign = winner.Name
+	decision.Bid = winner.Bid
+	decision.WinPrice = price
+	return decision
+}
+
+// withinPacing spreads a campaign's budget evenly over the simulation window: a campaign
+// may not spend more than its budget share for the elapsed time plus one impression.
+func (a *AdServer) withinPacing(c config.AdCampaign, at time.Time) bool {
+	if c.Budget <= 0 {
+		return true
+	}
+	spent := a.spend[c.Name]
+	if spent+c.Bid > c.Budget {
+		return false
+	}
+	window := a.end.Sub(a.start)
+	if window <= 0 {
+		return true
+	}
+	elapsed := at.Sub(a.start).Seconds() / window.Seconds()
+	if elapsed > 1 {
+		elapsed = 1
+	}
+	return spent < c.Budget*elapsed+c.Bid
+}
+
+func (a *AdServer) noFillReason() string {
+	if len(a.campaigns) == 0 {
+		return "no-campaigns"
+	}
+	return "no-eligible-bids"
+}
+
+// matchesTargeting checks the request against every targeting dimension the campaign sets.
+func matchesTargeting(t config.AdTargeting, req AdRequest) bool {
+	if len(t.Tiers) > 0 && !containsFold(t.Tiers, string(req.Tier)) {
+		return false
+	}
+	if len(t.Devices) > 0 && !containsFold(t.Devices, req.Device) {
+		return false
+	}
+	if len(t.Genres) > 0 {
+		for _, genre := range req.Genres {
+			if containsFold(t.Genres, genre) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func newTestAdServer(floor float64, campaigns ...config.AdCampaign) *AdServer {
+	start := time.Date(2024, time.April, 18, 0, 0, 0, 0, time.UTC)
+	return NewAdServer(&config.Config{
+		StartTime: start,
+		EndTime:   start.Add(10 * time.Hour),
+		AdConfig:  config.AdConfig{FloorPrice: floor, Campaigns: campaigns},
+	})
+}
+
+func TestAdServerChargesTheSecondPrice(t *testing.T) {
+	tests := []struct {
+		name      string
+		floor     float64
+		campaigns []config.AdCampaign
+		campaign  string
+		price     float64
+	}{
+		{"second highest bid", 0.001, []config.AdCampaign{{Name: "low", Bid: 0.005}, {Name: "high", Bid: 0.01}, {Name: "mid", Bid: 0.008}}, "high", 0.008},
+		{"floor with a single bidder", 0.002, []config.AdCampaign{{Name: "only", Bid: 0.01}}, "only", 0.002},
+		{"bids below the floor are dropped", 0.006, []config.AdCampaign{{Name: "low", Bid: 0.005}, {Name: "high", Bid: 0.01}}, "high", 0.006},
+		{"nobody bids the floor", 0.02, []config.AdCampaign{{Name: "low", Bid: 0.005}}, "", 0},
+	}
+	for _, tt := range tests {
+		server := newTestAdServer(tt.floor, tt.campaigns...)
+		d := server.Decide(AdRequest{Time: server.start}, nil)
+		if d.Campaign != tt.campaign || d.WinPrice != tt.price || d.Filled != (tt.campaign != "") {
+			t.Errorf("%s: won by %q at %g (filled %v), want %q at %g", tt.name, d.Campaign, d.WinPrice, d.Filled, tt.campaign, tt.price)
+		}
+	}
+}
+
+func TestAdServerMatchesTargeting(t *testing.T) {
+	server := newTestAdServer(0,
+		config.AdCampaign{Name: "sport-mobile", Bid: 0.01, Targeting: config.AdTargeting{Genres: []string{"Sport"}, Devices: []string{"smartphone"}}},
+		config.AdCampaign{Name: "free-tier", Bid: 0.005, Targeting: config.AdTargeting{Tiers: []string{"free"}}},
+	)
+	tests := []struct {
+		req  AdRequest
+		want string
+	}{
+		{AdRequest{Genres: []string{"sport"}, Device: "Smartphone", Tier: Premium}, "sport-mobile"},
+		{AdRequest{Genres: []string{"Sport"}, Device: "desktop", Tier: Free}, "free-tier"},
+		{AdRequest{Genres: []string{"Drama"}, Device: "smartphone", Tier: Premium}, ""},
+	}
+	for _, tt := range tests {
+		tt.req.Time = server.start
+		if d := server.Decide(tt.req, nil); d.Campaign != tt.want {
+			t.Errorf("%+v won by %q, want %q", tt.req, d.Campaign, tt.want)
+		}
+	}
+}
+
+func TestAdServerPacesBudgets(t *testing.T) {
+	// a budget of 10 impressions spread over 10 hours allows one impression per hour, plus one
+	server := newTestAdServer(0.01, config.AdCampaign{Name: "paced", Bid: 0.01, Budget: 0.1})
+	served := 0
+	for i := 0; i < 5; i++ {
+		if server.Decide(AdRequest{Time: server.start.Add(90 * time.Minute)}, nil).Filled {
+			served++
+		}
+	}
+	if served != 3 {
+		t.Errorf("served %d impressions in the first 90 minutes, want 3", served)
+	}
+	for i := 0; i < 20; i++ {
+		server.Decide(AdRequest{Time: server.end}, nil)
+	}
+	if spent := server.spend["paced"]; spent > 0.1+1e-9 {
+		t.Errorf("spent %g, more than the budget", spent)
+	}
+	if d := server.Decide(AdRequest{Time: server.end}, func(config.AdCampaign) bool { return true }); d.Filled {
+		t.Error("served an impression after the budget ran out")
+	}
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// ChainAnalysis describes sessions as an absorbing Markov chain over the states of an
+// AuthLevelStateMap: each page view moves along a transition, and the probability a state's
+// transitions leave unassigned is the chance the session ends there.
+type ChainAnalysis struct {
+	Visits         map[*State]float64 // expected page views of each state per session
+	Absorption     map[*State]float64 // chance the session ends on each state
+	ExpectedEvents float64            // expected page views per session
+	ExpectedTime   time.Duration      // expected time from the first to the last page view
+}
+
+// StartDistribution returns the chance a session of the given auth and level opens on each
+// state, from the new-session page weights.
+func (alm *AuthLevelStateMap) StartDistribution(auth, level string) map[*State]float64 {
+	gen, ok := alm.Generators[auth+"|"+level]
+	if !ok || gen.totalWeight <= 0 {
+		return nil
+	}
+	start := make(map[*State]float64)
+	for _, item := range gen.items {
+		start[item.Value] += float64(item.Weight) / float64(gen.totalWeight)
+	}
+	return start
+}
+
+// Analyze solves the chain for sessions opening with the start distribution. Each page view
+// follows the mean dwell time of its page, as in Session.IncrementEvent; time spent playing
+// videos and songs is not included. It returns an error when sessions can get stuck in a
+// loop of pages they never leave.
+func (alm *AuthLevelStateMap) Analyze(start map[*State]float64, cfg *config.Config) (*ChainAnalysis, error) {
+	n := len(alm.States)
+	index := make(map[*State]int, n)
+	for i, state := range alm.States {
+		index[state] = i
+	}
+
+	// The expected visits v solve v = start + vQ, that is (I - Q)ᵀ v = start.
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+		a[i][i] = 1
+	}
+	for i, state := range alm.States {
+		for target, p := range state.transitions() {
+			a[index[target]][i] -= p
+		}
+	}
+	for state, p := range start {
+		a[index[state]][n] += p
+	}
+	visits, err := solve(a)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := &ChainAnalysis{
+		Visits:     make(map[*State]float64, n),
+		Absorption: make(map[*State]float64, n),
+	}
+	seconds := 0.0
+	for i, state := range alm.States {
+		v := visits[i]
+		if v < -1e-9 {
+			return nil, fmt.Errorf("sessions reaching %s %s never end", state.Method, state.Page)
+		}
+		if v <= 0 {
+			continue
+		}
+		analysis.Visits[state] = v
+		analysis.ExpectedEvents += v
+		leave := 0.0
+		for _, p := range state.transitions() {
+			leave += p
+		}
+		seconds += v * leave * meanDwell(cfg, state)
+		if end := 1 - leave; end > 1e-12 {
+			analysis.Absorption[state] = v * end
+		}
+	}
+	analysis.ExpectedTime = time.Duration(seconds * float64(time.Second))
+	return analysis, nil
+}
+
+// PageDistribution returns the long-run share of page views on each page, whatever the
+// auth and level. Sessions restart when they end, so this is the stationary distribution of
+// the chain in which the end of a session leads to the start of the next.
+func (c *ChainAnalysis) PageDistribution() map[string]float64 {
+	pages := make(map[string]float64)
+	for state, v := range c.Visits {
+		pages[state.Page] += v / c.ExpectedEvents
+	}
+	return pages
+}
+
+// MixAnalyses combines analyses of sessions starting with different auths and levels,
+// weighing each by how often sessions start that way.
+func MixAnalyses(analyses []*ChainAnalysis, weights []float64) *ChainAnalysis {
+	mixed := &ChainAnalysis{Visits: make(map[*State]float64), Absorption: make(map[*State]float64)}
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return mixed
+	}
+	for i, analysis := range analyses {
+		w := weights[i] / total
+		for state, v := range analysis.Visits {
+			mixed.Visits[state] += w * v
+		}
+		for state, p := range analysis.Absorption {
+			mixed.Absorption[state] += w * p
+		}
+		mixed.ExpectedEvents += w * analysis.ExpectedEvents
+		mixed.ExpectedTime += time.Duration(w * float64(analysis.ExpectedTime))
+	}
+	return mixed
+}
+
+// transitions returns the probability of moving to each state, whatever the transition type.
+func (s *State) transitions() map[*State]float64 {
+	combined := make(map[*State]float64, len(s.Laterals)+len(s.Upgrades)+len(s.Downgrades))
+	for _, transitions := range []map[*State]float64{s.Laterals, s.Upgrades, s.Downgrades} {
+		for state, p := range transitions {
+			combined[state] += p
+		}
+	}
+	return combined
+}
+
+// solve solves the linear system given as an augmented matrix by Gaussian elimination with
+// partial pivoting.
+func solve(a [][]float64) ([]float64, error) {
+	n := len(a)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("sessions can loop forever without ending")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := col + 1; row < n; row++ {
+			factor := a[row][col] / a[col][col]
+			for k := col; k <= n; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+		}
+	}
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := a[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * x[k]
+		}
+		x[row] = sum / a[row][row]
+	}
+	return x, nil
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func TestAnalyzeSolvesTheChain(t *testing.T) {
+	home := NewState("Home", 200, "GET", "free", "Logged In", time.Time{})
+	about := NewState("About", 200, "GET", "free", "Logged In", time.Time{})
+	home.AddLateralTransition(about, 0.5)
+	about.AddLateralTransition(home, 0.5)
+	stateMap := NewAuthLevelStateMap()
+	stateMap.States = []*State{home, about}
+	stateMap.Add("Logged In", "free", home, 1)
+
+	cfg := &config.Config{Alpha: 60}
+	analysis, err := stateMap.Analyze(stateMap.StartDistribution("Logged In", "free"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-9 }
+	if !near(analysis.ExpectedEvents, 2) || analysis.ExpectedTime.Round(time.Second) != time.Minute {
+		t.Errorf("expected %g page views over %v, want 2 over 1m", analysis.ExpectedEvents, analysis.ExpectedTime)
+	}
+	if !near(analysis.Absorption[home], 2.0/3) || !near(analysis.Absorption[about], 1.0/3) {
+		t.Errorf("absorption = %v, want 2/3 on Home and 1/3 on About", analysis.Absorption)
+	}
+	if pages := analysis.PageDistribution(); !near(pages["Home"], 2.0/3) {
+		t.Errorf("page distribution = %v, want 2/3 of page views on Home", pages)
+	}
+
+	home.Laterals[about] = 1
+	about.Laterals[home] = 1
+	if _, err := stateMap.Analyze(stateMap.StartDistribution("Logged In", "free"), cfg); err == nil {
+		t.Error("sessions that never end were analyzed")
+	}
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Billing tracks a user's billing cycle and the retries of a failed charge.
+type Billing struct {
+	NextCharge time.Time // next renewal or retry, zero when the user has nothing to pay
+	Attempts   int       // failed attempts of the current charge
+	LastCharge float64   // amount of the last successful charge, refundable when leaving the plan
+	invoices   int
+}
+
+type BillingEvent struct {
+	Timestamp        int64   `json:"ts"`
+	UserID           int64   `json:"userId"`
+	InvoiceID        string  `json:"invoiceId"`
+	EventType        string  `json:"eventType"` // charge, renewal, payment_failed, dunning_exhausted or refund
+	SubscriptionType string  `json:"subscriptionType"`
+	Amount           float64 `json:"amount"`
+	Currency         string  `json:"currency"`
+	Region           string  `json:"region"`
+	Attempt          int     `json:"attempt,omitempty"`
+}
+
+// planPrice returns the price of one billing cycle of the tier in the user's currency.
+func (u *User) planPrice(tier SubscriptionType) float64 {
+	t, ok := u.Config.Tier(string(tier))
+	if !ok {
+		return 0
+	}
+	multiplier := u.Region.PriceMultiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+	return math.Round(t.Price*multiplier*100) / 100
+}
+
+func (u *User) billingCycleDays() int {
+	if u.Config.Billing.CycleDays > 0 {
+		return u.Config.Billing.CycleDays
+	}
+	return 30
+}
+
+func (u *User) retryIntervalDays() int {
+	if u.Config.Billing.RetryIntervalDays > 0 {
+		return u.Config.Billing.RetryIntervalDays
+	}
+	return 1
+}
+
+// startBillingCycle anchors the billing cycle of a user who already pays when the simulation
+// starts at a random point of their current cycle.
+func (u *User) startBillingCycle(at time.Time) {
+	price := u.planPrice(u.SubscriptionType)
+	if price <= 0 {
+		return
+	}
+	u.Billing.LastCharge = price
+	u.Billing.NextCharge = at.AddDate(0, 0, 1+u.Rng.Intn(u.billingCycleDays()))
+}
+
+// advanceBilling renews the plan for every charge date the user's clock has passed.
+func (u *User) advanceBilling(now time.Time) {
+	b := &u.Billing
+	for !b.NextCharge.IsZero() && !now.Before(b.NextCharge) {
+		if !u.Subscription.CancelAt.IsZero() {
+			b.NextCharge = time.Time{} // cancelled plans run out their grace period without renewing
+			return
+		}
+		u.charge(u.SubscriptionType, "renewal", b.NextCharge)
+	}
+}
+
+// billTierChange charges for a newly started paid plan and stops billing, possibly with a
+// refund, when the user leaves paid plans altogether. Plans that ran out their grace period
+// or were dropped for failed payments are not refunded.
+func (u *User) billTierChange(change *StatusChange) {
+	switch change.Reason {
+	case "trial-started", "trial-expired", "trial-cancelled", "cancel-scheduled":
+		return // trials are free and cancelled plans are paid up to the end of their grace period
+	case "trial-converted", "upgrade":
+		if u.planPrice(change.New) > 0 {
+			u.charge(change.New, "charge", change.Time)
+		}
+		return
+	}
+	b := &u.Billing
+	if u.planPrice(change.New) > 0 || b.NextCharge.IsZero() {
+		return // still paying, renewals continue at the new tier's price
+	}
+	b.NextCharge = time.Time{}
+	b.Attempts = 0
+	if change.Reason != "payment-failed" && change.Reason != "grace-expired" && b.LastCharge > 0 && u.Rng.Float64() < u.Config.Billing.RefundRate {
+		u.queueBillingEvent("refund", change.Old, -b.LastCharge, change.Time, 0)
+	}
+}
+
+// charge bills one cycle of the tier at the given time. A failed payment is retried after
+// the retry interval; once the retries run out the user is dropped to the cheapest tier,
+// which is billed again one cycle later if it has a price.
+func (u *User) charge(tier SubscriptionType, eventType string, at time.Time) {
+	b := &u.Billing
+	amount := u.planPrice(tier)
+	attempt := b.Attempts + 1
+	if u.Rng.Float64() < u.Config.Billing.PaymentFailureRate {
+		b.Attempts = attempt
+		u.queueBillingEvent("payment_failed", tier, amount, at, attempt)
+		if b.Attempts > u.Config.Billing.MaxRetries {
+			u.queueBillingEvent("dunning_exhausted", tier, 0, at, attempt)
+			b.Attempts = 0
+			b.NextCharge = at.AddDate(0, 0, u.billingCycleDays()) // a priced cheapest tier is billed from the next cycle
+			u.queueStatusChange(u.changeTier(tierLadder(u.Config)[0], "payment-failed", at))
+			return
+		}
+		b.NextCharge = at.AddDate(0, 0, u.retryIntervalDays())
+		return
+	}
+	if attempt == 1 {
+		attempt = 0 // only retries report their attempt number
+	}
+	b.Attempts = 0
+	b.LastCharge = amount
+	b.NextCharge = at.AddDate(0, 0, u.billingCycleDays())
+	u.queueBillingEvent(eventType, tier, amount, at, attempt)
+}
+
+func (u *User) queueBillingEvent(eventType string, tier SubscriptionType, amount float64, at time.Time, attempt int) {
+	u.Billing.invoices++
+	u.queueEvent("billing_events", BillingEvent{
+		Timestamp:        at.Unix(),
+		UserID:           u.ID,
+		InvoiceID:        fmt.Sprintf("inv-%d-%d", u.ID, u.Billing.invoices),
+		EventType:        eventType,
+		SubscriptionType: string(tier),
+		Amount:           amount,
+		Currency:         u.Region.Currency,
+		Region:           u.Region.Name,
+		Attempt:          attempt,
+	})
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func TestChargeRetriesFailedPayments(t *testing.T) {
+	tests := []struct {
+		name       string
+		tiers      []config.SubscriptionTier
+		billing    config.BillingConfig
+		topics     []string
+		tier       SubscriptionType
+		nextCharge int // days after the first charge, 0 when billing stopped
+	}{
+		{
+			"paid",
+			nil,
+			config.BillingConfig{CycleDays: 30},
+			[]string{"billing_events"},
+			Basic, 30,
+		},
+		{
+			"retried until the retries run out",
+			nil,
+			config.BillingConfig{CycleDays: 30, PaymentFailureRate: 1, MaxRetries: 2, RetryIntervalDays: 3},
+			[]string{"billing_events", "billing_events", "billing_events", "billing_events", "status_change_events"},
+			Free, 0,
+		},
+		{
+			"retries run out on a priced cheapest tier",
+			subscriptionTiers[1:],
+			config.BillingConfig{CycleDays: 30, PaymentFailureRate: 1, MaxRetries: 2, RetryIntervalDays: 3},
+			[]string{"billing_events", "billing_events", "billing_events", "billing_events", "status_change_events"},
+			Basic, 36,
+		},
+	}
+	for _, tt := range tests {
+		u := newSubscriber(&config.Config{SubscriptionTiers: tt.tiers, Billing: tt.billing}, Basic)
+		start := u.CurrentSession.NextEventTime
+		u.charge(Basic, "renewal", start)
+		u.advanceBilling(start.AddDate(0, 0, 10))
+
+		if topics := queuedTopics(t, u); !reflect.DeepEqual(topics, tt.topics) {
+			t.Errorf("%s: queued %v, want %v", tt.name, topics, tt.topics)
+		}
+		if u.SubscriptionType != tt.tier {
+			t.Errorf("%s: tier = %s, want %s", tt.name, u.SubscriptionType, tt.tier)
+		}
+		want := time.Time{}
+		if tt.nextCharge > 0 {
+			want = start.AddDate(0, 0, tt.nextCharge)
+		}
+		if !u.Billing.NextCharge.Equal(want) {
+			t.Errorf("%s: next charge %v, want %v", tt.name, u.Billing.NextCharge, want)
+		}
+	}
+}
+
+func TestRefundsOnlyImmediateCancellations(t *testing.T) {
+	tests := []struct {
+		name   string
+		grace  int
+		topics []string
+	}{
+		{"cancelled straight away", 0, []string{"billing_events"}},
+		{"grace period ran out", 7, []string{"status_change_events"}},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{
+			Billing:               config.BillingConfig{CycleDays: 30, RefundRate: 1},
+			SubscriptionLifecycle: config.SubscriptionLifecycle{GracePeriodDays: tt.grace},
+		}
+		u := newSubscriber(cfg, Premium)
+		start := u.CurrentSession.NextEventTime
+		u.charge(Premium, "renewal", start)
+		u.FlushEvents()
+
+		u.cancel(start)
+		u.CurrentSession.NextEventTime = start.AddDate(0, 0, tt.grace)
+		u.advanceSubscription("")
+
+		if topics := queuedTopics(t, u); !reflect.DeepEqual(topics, tt.topics) {
+			t.Errorf("%s: queued %v, want %v", tt.name, topics, tt.topics)
+		}
+		if u.SubscriptionType != Free || !u.Billing.NextCharge.IsZero() {
+			t.Errorf("%s: still on %s, billed next at %v", tt.name, u.SubscriptionType, u.Billing.NextCharge)
+		}
+	}
+}
+
+func TestWithdrawnCancellationsRenew(t *testing.T) {
+	cfg := &config.Config{
+		Billing:               config.BillingConfig{CycleDays: 30},
+		SubscriptionLifecycle: config.SubscriptionLifecycle{GracePeriodDays: 7},
+	}
+	u := newSubscriber(cfg, Premium)
+	start := u.CurrentSession.NextEventTime
+	u.charge(Premium, "renewal", start)
+	u.cancel(start.AddDate(0, 0, 28))
+	u.advanceBilling(start.AddDate(0, 0, 31))
+	if !u.Billing.NextCharge.IsZero() {
+		t.Fatalf("cancelled plan billed next at %v", u.Billing.NextCharge)
+	}
+
+	if change := u.upgrade("", start.AddDate(0, 0, 31)); change != nil {
+		t.Fatalf("upgrade on the top tier changed %v", change)
+	}
+	if want := start.AddDate(0, 0, 35); !u.Billing.NextCharge.Equal(want) {
+		t.Errorf("next charge %v, want %v", u.Billing.NextCharge, want)
+	}
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// defaultDwells apply to the pages no configured dwell matches: redirects are followed after
+// a second. Every other page falls back to an exponential dwell with mean alpha.
+var defaultDwells = []config.DwellConfig{{Status: "3xx", Distribution: "fixed", Mean: 1}}
+
+// findDwell returns the dwell configuration of the state: the first configured entry that
+// matches it, then the defaults.
+func findDwell(cfg *config.Config, state *State) (config.DwellConfig, bool) {
+	for _, dwells := range [][]config.DwellConfig{cfg.Dwell, defaultDwells} {
+		for _, d := range dwells {
+			if d.Matches(state.Page, state.StatusCode) {
+				return d, true
+			}
+		}
+	}
+	return config.DwellConfig{}, false
+}
+
+// dwell draws how long the session stays on the state's page before its next page view,
+// so a redirect page is left after a second.
+func (s *Session) dwell(state *State) time.Duration {
+	d, _ := findDwell(s.Config, state)
+	seconds := sampleDwell(s.Rng, d, s.Alpha)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// meanDwell returns the expected dwell in seconds on the state's page before the next page view.
+func meanDwell(cfg *config.Config, state *State) float64 {
+	d, _ := findDwell(cfg, state)
+	return d.MeanSeconds(cfg.Alpha)
+}
+
+// sampleDwell draws a dwell in seconds from the distribution.
+func sampleDwell(rng *rand.Rand, d config.DwellConfig, alpha float64) float64 {
+	mean := d.MeanSeconds(alpha)
+	switch d.Distribution {
+	case "fixed":
+		return mean
+	case "log-normal":
+		if d.StdDev <= 0 || mean <= 0 {
+			return mean
+		}
+		// mu and sigma of the underlying normal distribution that give the mean and stddev
+		sigma2 := math.Log(1 + d.StdDev*d.StdDev/(mean*mean))
+		mu := math.Log(mean) - sigma2/2
+		return math.Exp(mu + math.Sqrt(sigma2)*rng.NormFloat64())
+	case "gamma":
+		shape := d.Shape
+		if shape <= 0 {
+			shape = 1
+		}
+		return gammaRandomValue(rng, shape) * mean / shape
+	case "empirical":
+		return empiricalRandomValue(rng, d.Histogram)
+	default:
+		return exponentialRandomValue(rng, mean)
+	}
+}
+
+// gammaRandomValue draws from a gamma distribution with the given shape and scale 1, using
+// the method of Marsaglia and Tsang.
+func gammaRandomValue(rng *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		// boost to shape+1 and scale back, as the method needs a shape of at least 1
+		return gammaRandomValue(rng, shape+1) * math.Pow(rng.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < x*x/2+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// empiricalRandomValue picks a histogram bin by its weight and a value uniformly within it.
+func empiricalRandomValue(rng *rand.Rand, bins []config.DwellBin) float64 {
+	total := 0.0
+	for _, bin := range bins {
+		total += bin.Weight
+	}
+	if total <= 0 {
+		return 0
+	}
+	target := rng.Float64() * total
+	lower := 0.0
+	for _, bin := range bins {
+		if target < bin.Weight {
+			return lower + rng.Float64()*(bin.Upper-lower)
+		}
+		target -= bin.Weight
+		lower = bin.Upper
+	}
+	return lower
+}
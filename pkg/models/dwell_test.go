@@ -0,0 +1,98 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func TestFindDwellPrefersConfiguredEntries(t *testing.T) {
+	cfg := &config.Config{Dwell: []config.DwellConfig{
+		{Page: "Help", Distribution: "gamma", Shape: 2},
+		{Status: "404", Distribution: "fixed", Mean: 5},
+	}}
+	tests := []struct {
+		page   string
+		status int
+		want   string
+		ok     bool
+	}{
+		{"Help", 200, "gamma", true},
+		{"Error", 404, "fixed", true},
+		{"Submit Upgrade", 307, "fixed", true},
+		{"Home", 200, "", false},
+	}
+	for _, tt := range tests {
+		d, ok := findDwell(cfg, &State{Page: tt.page, StatusCode: tt.status})
+		if ok != tt.ok || d.Distribution != tt.want {
+			t.Errorf("dwell of %s %d = %q, %v, want %q, %v", tt.page, tt.status, d.Distribution, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRedirectsDwellASecondByDefault(t *testing.T) {
+	cfg := &config.Config{Alpha: 90}
+	redirect := &State{Page: "Submit Upgrade", StatusCode: 307}
+	if got := meanDwell(cfg, redirect); got != 1 {
+		t.Errorf("mean redirect dwell = %g, want 1", got)
+	}
+	if got := meanDwell(cfg, &State{Page: "Home", StatusCode: 200}); got != 90 {
+		t.Errorf("mean Home dwell = %g, want alpha", got)
+	}
+}
+
+func TestSampleDwellDistributions(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	histogram := []config.DwellBin{{Upper: 10, Weight: 1}, {Upper: 30, Weight: 3}}
+	tests := []struct {
+		d    config.DwellConfig
+		mean float64
+	}{
+		{config.DwellConfig{}, 90},
+		{config.DwellConfig{Distribution: "log-normal", Mean: 60, StdDev: 40}, 60},
+		{config.DwellConfig{Distribution: "gamma", Mean: 60, Shape: 3}, 60},
+		{config.DwellConfig{Distribution: "gamma", Mean: 60, Shape: 0.5}, 60},
+		{config.DwellConfig{Distribution: "empirical", Histogram: histogram}, 0.25*5 + 0.75*20},
+	}
+	for _, tt := range tests {
+		const n = 20000
+		sum := 0.0
+		for i := 0; i < n; i++ {
+			v := sampleDwell(rng, tt.d, 90)
+			if v < 0 {
+				t.Fatalf("%s dwell %g is negative", tt.d.Distribution, v)
+			}
+			if tt.d.Distribution == "empirical" && v > 30 {
+				t.Fatalf("empirical dwell %g is beyond the last bin", v)
+			}
+			sum += v
+		}
+		if mean := sum / n; math.Abs(mean-tt.mean) > tt.mean*0.05 {
+			t.Errorf("%q dwell mean = %g, want about %g", tt.d.Distribution, mean, tt.mean)
+		}
+		if got := tt.d.MeanSeconds(90); got != tt.mean {
+			t.Errorf("%q MeanSeconds = %g, want %g", tt.d.Distribution, got, tt.mean)
+		}
+	}
+}
+
+func TestDwellIsSpentOnThePageBeingLeft(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 20, 0, 0, 0, time.UTC)
+	help := NewState("Help", 200, "GET", "free", "Logged In", time.Time{})
+	submit := NewState("Submit Upgrade", 307, "PUT", "free", "Logged In", time.Time{})
+	home := NewState("Home", 200, "GET", "free", "Logged In", time.Time{})
+	help.AddLateralTransition(submit, 1)
+	submit.AddLateralTransition(home, 1)
+	cfg := &config.Config{Alpha: 90, Dwell: []config.DwellConfig{{Page: "Help", Distribution: "fixed", Mean: 30}, {Page: "Home", Distribution: "fixed", Mean: 600}}}
+	session := &Session{Rng: rand.New(rand.NewSource(1)), Config: cfg, Alpha: cfg.Alpha, Auth: "Logged In", Level: "free", CurrentState: help, NextEventTime: start}
+
+	for _, want := range []time.Duration{30 * time.Second, 31 * time.Second} {
+		session.IncrementEvent()
+		if got := session.NextEventTime.Sub(start); got != want {
+			t.Errorf("%s viewed %v in, want %v", session.CurrentState.Page, got, want)
+		}
+	}
+}
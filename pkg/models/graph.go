@@ -0,0 +1,169 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// graphGroup is the states of one auth and level, which the graph draws together.
+type graphGroup struct {
+	Auth   string
+	Level  string
+	States []*State
+}
+
+// graph lists the states by auth and level and assigns every state a node ID, in the order
+// the configuration declares them so the output is stable.
+func (alm *AuthLevelStateMap) graph() (groups []*graphGroup, ids map[*State]string, order map[*State]int) {
+	ids = make(map[*State]string, len(alm.States))
+	order = make(map[*State]int, len(alm.States))
+	byKey := make(map[string]*graphGroup)
+	for i, state := range alm.States {
+		ids[state] = fmt.Sprintf("s%d", i)
+		order[state] = i
+		key := state.AuthStatus + "|" + state.UserLevel
+		group, ok := byKey[key]
+		if !ok {
+			group = &graphGroup{Auth: state.AuthStatus, Level: state.UserLevel}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.States = append(group.States, state)
+	}
+	return groups, ids, order
+}
+
+// graphEdge is a transition of the graph.
+type graphEdge struct {
+	To   *State
+	P    float64
+	Type string
+}
+
+// edges returns the state's transitions ordered by target node, and the probability that
+// the session ends on the state instead.
+func (s *State) edges(order map[*State]int) (edges []graphEdge, end float64) {
+	end = 1
+	for to, p := range s.transitions() {
+		edges = append(edges, graphEdge{To: to, P: p, Type: s.TransitionType(to)})
+		end -= p
+	}
+	sort.Slice(edges, func(i, j int) bool { return order[edges[i].To] < order[edges[j].To] })
+	if end < 1e-9 {
+		end = 0
+	}
+	return edges, end
+}
+
+// WriteDOT renders the state graph in Graphviz DOT. States are grouped in a cluster per
+// auth and level, edges carry their probabilities, upgrades are drawn green and downgrades
+// red. States with no transitions are dead ends, filled red, and the probability of a
+// session ending on a state is drawn as a dashed edge to the session end node.
+func (alm *AuthLevelStateMap) WriteDOT(w io.Writer) error {
+	groups, ids, order := alm.graph()
+	var b strings.Builder
+	b.WriteString("digraph sessions {\n")
+	b.WriteString("  rankdir=LR;\n  node [shape=box, style=rounded];\n")
+	b.WriteString("  end [label=\"session end\", shape=doublecircle, style=filled, fillcolor=lightgrey];\n")
+	for i, group := range groups {
+		fmt.Fprintf(&b, "  subgraph cluster_%d {\n    label=%q;\n", i, group.Auth+", "+group.Level)
+		for _, state := range group.States {
+			attrs := ""
+			if len(state.transitions()) == 0 {
+				attrs = ", style=\"rounded,filled\", fillcolor=\"#f4a6a6\", xlabel=\"dead end\""
+			}
+			fmt.Fprintf(&b, "    %s [label=%q%s];\n", ids[state], nodeLabel(state, "\n"), attrs)
+		}
+		b.WriteString("  }\n")
+	}
+	for _, state := range alm.States {
+		edges, end := state.edges(order)
+		for _, edge := range edges {
+			color := ""
+			switch edge.Type {
+			case "upgrade":
+				color = ", color=darkgreen, fontcolor=darkgreen"
+			case "downgrade":
+				color = ", color=red, fontcolor=red"
+			}
+			fmt.Fprintf(&b, "  %s -> %s [label=\"%s\"%s];\n", ids[state], ids[edge.To], formatProbability(edge.P), color)
+		}
+		if end > 0 {
+			fmt.Fprintf(&b, "  %s -> end [label=\"%s\", style=dashed, color=grey, fontcolor=grey];\n", ids[state], formatProbability(end))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid renders the state graph as a Mermaid flowchart, with the same grouping and
+// highlighting as WriteDOT.
+func (alm *AuthLevelStateMap) WriteMermaid(w io.Writer) error {
+	groups, ids, order := alm.graph()
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	b.WriteString("  classDef deadEnd fill:#f4a6a6,stroke:#c00\n")
+	b.WriteString("  classDef sessionEnd fill:#ddd,stroke:#999\n")
+	b.WriteString("  end_((session end)):::sessionEnd\n")
+	var deadEnds []string
+	for i, group := range groups {
+		fmt.Fprintf(&b, "  subgraph g%d [\"%s, %s\"]\n", i, group.Auth, group.Level)
+		for _, state := range group.States {
+			fmt.Fprintf(&b, "    %s[\"%s\"]\n", ids[state], nodeLabel(state, "<br/>"))
+			if len(state.transitions()) == 0 {
+				deadEnds = append(deadEnds, ids[state])
+			}
+		}
+		b.WriteString("  end\n")
+	}
+	var upgrades, downgrades, leaks []int
+	edgeCount := 0
+	for _, state := range alm.States {
+		edges, end := state.edges(order)
+		for _, edge := range edges {
+			fmt.Fprintf(&b, "  %s -->|%s| %s\n", ids[state], formatProbability(edge.P), ids[edge.To])
+			switch edge.Type {
+			case "upgrade":
+				upgrades = append(upgrades, edgeCount)
+			case "downgrade":
+				downgrades = append(downgrades, edgeCount)
+			}
+			edgeCount++
+		}
+		if end > 0 {
+			fmt.Fprintf(&b, "  %s -.->|%s| end_\n", ids[state], formatProbability(end))
+			leaks = append(leaks, edgeCount)
+			edgeCount++
+		}
+	}
+	if len(deadEnds) > 0 {
+		fmt.Fprintf(&b, "  class %s deadEnd\n", strings.Join(deadEnds, ","))
+	}
+	writeLinkStyle(&b, upgrades, "stroke:darkgreen,color:darkgreen")
+	writeLinkStyle(&b, downgrades, "stroke:red,color:red")
+	writeLinkStyle(&b, leaks, "stroke:grey,color:grey")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeLinkStyle(b *strings.Builder, links []int, style string) {
+	if len(links) == 0 {
+		return
+	}
+	numbers := make([]string, len(links))
+	for i, link := range links {
+		numbers[i] = fmt.Sprint(link)
+	}
+	fmt.Fprintf(b, "  linkStyle %s %s\n", strings.Join(numbers, ","), style)
+}
+
+func nodeLabel(state *State, lineBreak string) string {
+	return fmt.Sprintf("%s%s%s %d", state.Page, lineBreak, state.Method, state.StatusCode)
+}
+
+func formatProbability(p float64) string {
+	return fmt.Sprintf("%.3g", p)
+}
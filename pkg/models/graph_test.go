@@ -0,0 +1,49 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphHighlightsDeadEndsAndSessionEnds(t *testing.T) {
+	home := NewState("Home", 200, "GET", "free", "Logged In", time.Time{})
+	logout := NewState("Logout", 307, "PUT", "free", "Logged In", time.Time{})
+	loggedOut := NewState("Home", 200, "GET", "free", "Logged Out", time.Time{})
+	home.AddLateralTransition(logout, 0.25)
+	logout.AddDowngradeTransition(loggedOut, 1)
+	stateMap := NewAuthLevelStateMap()
+	stateMap.States = []*State{home, logout, loggedOut}
+
+	var dot strings.Builder
+	if err := stateMap.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`label="Logged In, free"`,
+		`s0 -> s1 [label="0.25"];`,
+		`s0 -> end [label="0.75", style=dashed`,
+		`s1 -> s2 [label="1", color=red`,
+		`s2 [label="Home\nGET 200", style="rounded,filled"`,
+	} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("DOT output lacks %s:\n%s", want, dot.String())
+		}
+	}
+
+	var mermaid strings.Builder
+	if err := stateMap.WriteMermaid(&mermaid); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`subgraph g1 ["Logged Out, free"]`,
+		`s0 -->|0.25| s1`,
+		`s0 -.->|0.75| end_`,
+		`class s2 deadEnd`,
+		`linkStyle 2 stroke:red`,
+	} {
+		if !strings.Contains(mermaid.String(), want) {
+			t.Errorf("Mermaid output lacks %s:\n%s", want, mermaid.String())
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// defaultLiveDuration is the length of a live event that does not configure one.
+const defaultLiveDuration = 2 * time.Hour
+
+// defaultLiveHeartbeat is the heartbeat interval of live viewers when neither the event nor
+// playback configures one; concurrency metrics count viewers by their heartbeats.
+const defaultLiveHeartbeat = time.Minute
+
+// LiveStream is a scheduled live event with its times resolved against the simulation start.
+type LiveStream struct {
+	ID        string
+	Title     string
+	Genre     string
+	Start     time.Time
+	End       time.Time
+	Heartbeat time.Duration
+	Event     config.LiveEvent
+}
+
+// newLiveStreams resolves the configured live events. Events without a title are named after
+// a title of their genre from the catalog, so a Sport event borrows a sports movie's name.
+func newLiveStreams(cfg *config.Config, videos catalog.Catalog) []*LiveStream {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	streams := make([]*LiveStream, 0, len(cfg.LiveEvents))
+	for i, event := range cfg.LiveEvents {
+		start := cfg.StartTime.Add(time.Duration(event.StartDay * float64(24*time.Hour)))
+		if event.Start != "" {
+			if t, err := time.Parse(time.RFC3339, event.Start); err == nil {
+				start = t
+			}
+		}
+		duration := time.Duration(event.DurationMinutes) * time.Minute
+		if duration <= 0 {
+			duration = defaultLiveDuration
+		}
+		heartbeat := time.Duration(event.HeartbeatSeconds) * time.Second
+		if heartbeat <= 0 {
+			heartbeat = time.Duration(cfg.Playback.HeartbeatSeconds) * time.Second
+		}
+		if heartbeat <= 0 {
+			heartbeat = defaultLiveHeartbeat
+		}
+		stream := &LiveStream{
+			ID:        event.ID,
+			Title:     event.Title,
+			Genre:     event.Genre,
+			Start:     start,
+			End:       start.Add(duration),
+			Heartbeat: heartbeat,
+			Event:     event,
+		}
+		if stream.ID == "" {
+			stream.ID = fmt.Sprintf("live-%d", i+1)
+		}
+		if stream.Title == "" && videos != nil {
+			if seed := videos.Sample(rng, event.Genre); seed != nil {
+				stream.Title = seed.Title + " Live"
+			}
+		}
+		if stream.Title == "" {
+			stream.Title = stream.ID
+		}
+		streams = append(streams, stream)
+	}
+	return streams
+}
+
+// joinWindowOpens returns the earliest time a viewer may tune in, three standard deviations
+// of the join spread before the start.
+func (l *LiveStream) joinWindowOpens() time.Time {
+	spread := time.Duration(l.Event.JoinSpreadMinutes * float64(time.Minute))
+	return l.Start.Add(-3 * spread)
+}
+
+// LiveAction is a viewer joining, staying tuned in to or leaving a live stream.
+type LiveAction struct {
+	Time   time.Time
+	Type   string // join, heartbeat or leave
+	Stream *LiveStream
+	Joined time.Time // when the viewer joined
+}
+
+// planLiveViewing plans how long a viewer who tunes in at join watches the stream: an
+// exponentially distributed stay, or until the end when the event sets no mean stay.
+func planLiveViewing(rng *rand.Rand, stream *LiveStream, join time.Time) []LiveAction {
+	leave := stream.End
+	if mean := stream.Event.MeanStayMinutes; mean > 0 {
+		stay := time.Duration(rng.ExpFloat64() * mean * float64(time.Minute))
+		if join.Add(stay).Before(leave) {
+			leave = join.Add(stay)
+		}
+	}
+	actions := []LiveAction{{Time: join, Type: "join", Stream: stream, Joined: join}}
+	for t := join.Add(stream.Heartbeat); t.Before(leave) && len(actions) < maxPlaybackActions; t = t.Add(stream.Heartbeat) {
+		actions = append(actions, LiveAction{Time: t, Type: "heartbeat", Stream: stream, Joined: join})
+	}
+	return append(actions, LiveAction{Time: leave, Type: "leave", Stream: stream, Joined: join})
+}
+
+// liveStreams returns the platform's scheduled live events.
+func (s *Session) liveStreams() []*LiveStream {
+	if s.Platform == nil {
+		return nil
+	}
+	return s.Platform.LiveStreams
+}
+
+// joinLiveStreams gives an active session the chance to tune in to the live events under
+// way. Each user decides once per event, with the event's join share, at their first event
+// once the join window opens. A viewer who tunes in drops what they are watching and keeps
+// the stream on while they browse, like a title, until they leave it or start a title.
+// The actions of the stream are reported as the session's clock passes them.
+func (s *Session) joinLiveStreams() {
+	defer s.releaseLive()
+	if s.Finished || len(s.liveViewing) > 0 {
+		return // one stream at a time
+	}
+	for _, stream := range s.liveStreams() {
+		now := s.NextEventTime
+		if s.LiveDecisions[stream.ID] || now.Before(stream.joinWindowOpens()) || !now.Before(stream.End) {
+			continue
+		}
+		if s.LiveDecisions == nil {
+			s.LiveDecisions = make(map[string]bool)
+		}
+		s.LiveDecisions[stream.ID] = true
+		if s.Rng.Float64() >= stream.Event.JoinShare {
+			continue
+		}
+		spread := stream.Event.JoinSpreadMinutes * float64(time.Minute)
+		join := stream.Start.Add(time.Duration(s.Rng.NormFloat64() * spread))
+		if join.Before(now) {
+			join = now
+		}
+		if !join.Before(stream.End) {
+			continue
+		}
+		s.stopPlayback(join)
+		s.CurrentMovie = nil
+		s.CurrentEpisode = nil
+		s.liveViewing = planLiveViewing(s.Rng, stream, join)
+		return
+	}
+}
+
+// releaseLive reports the live actions up to the session's next event. When the session
+// finishes the viewer watches on until they planned to leave.
+func (s *Session) releaseLive() {
+	if len(s.liveViewing) == 0 {
+		return
+	}
+	until := s.NextEventTime
+	if s.Finished {
+		until = s.liveViewing[len(s.liveViewing)-1].Time
+	}
+	released := 0
+	for released < len(s.liveViewing) && !s.liveViewing[released].Time.After(until) {
+		released++
+	}
+	s.liveActions = append(s.liveActions, s.liveViewing[:released]...)
+	s.liveViewing = s.liveViewing[released:]
+}
+
+// stopLive makes the viewer leave the live stream they are watching at the given time, or
+// not tune in at all if they were yet to join it.
+func (s *Session) stopLive(at time.Time) {
+	if len(s.liveViewing) == 0 {
+		return
+	}
+	leave := s.liveViewing[len(s.liveViewing)-1]
+	if !at.Before(leave.Time) {
+		return
+	}
+	if at.Before(leave.Joined) {
+		s.liveViewing = nil
+		return
+	}
+	kept := s.liveViewing[:0]
+	for _, action := range s.liveViewing {
+		if action.Time.Before(at) {
+			kept = append(kept, action)
+		}
+	}
+	leave.Time = at
+	s.liveViewing = append(kept, leave)
+	s.releaseLive()
+}
+
+// TakeLiveActions returns the live stream actions that happened since the last call.
+func (s *Session) TakeLiveActions() []LiveAction {
+	actions := s.liveActions
+	s.liveActions = nil
+	return actions
+}
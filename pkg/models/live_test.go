@@ -0,0 +1,76 @@
+package models
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func TestJoinLiveStreamsTunesInOnce(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 20, 0, 0, 0, time.UTC)
+	cfg := &config.Config{
+		StartTime: start,
+		LiveEvents: []config.LiveEvent{
+			{ID: "final", Title: "Cup Final", DurationMinutes: 90, JoinShare: 1, HeartbeatSeconds: 600},
+		},
+	}
+	platform := &Platform{LiveStreams: newLiveStreams(cfg, nil)}
+	session := &Session{Rng: rand.New(rand.NewSource(1)), Config: cfg, Platform: platform, NextEventTime: start.Add(-time.Minute)}
+
+	session.joinLiveStreams()
+	if actions := session.TakeLiveActions(); len(actions) != 0 {
+		t.Fatalf("joined before the stream started: %+v", actions)
+	}
+
+	session.NextEventTime = start.Add(5 * time.Minute)
+	session.joinLiveStreams()
+	if actions := session.TakeLiveActions(); len(actions) != 1 || actions[0].Type != "join" || !actions[0].Time.Equal(session.NextEventTime) {
+		t.Fatalf("got %+v, want to join on arrival and nothing ahead of the session's clock", actions)
+	}
+
+	// heartbeats every ten minutes from the join are reported as the session moves on
+	session.NextEventTime = start.Add(30 * time.Minute)
+	session.joinLiveStreams()
+	if actions := session.TakeLiveActions(); len(actions) != 2 || actions[0].Type != "heartbeat" || !actions[1].Time.Equal(start.Add(25*time.Minute)) {
+		t.Errorf("got %+v, want the heartbeats at 15 and 25 minutes", actions)
+	}
+
+	session.Finished = true
+	session.joinLiveStreams()
+	actions := session.TakeLiveActions()
+	if len(actions) != 7 {
+		t.Fatalf("got %d actions, want the 6 remaining heartbeats and a leave", len(actions))
+	}
+	if last := actions[len(actions)-1]; last.Type != "leave" || !last.Time.Equal(start.Add(90*time.Minute)) {
+		t.Errorf("left %+v, want to stay to the end once the session finished", last)
+	}
+
+	session.Finished = false
+	session.NextEventTime = start.Add(40 * time.Minute)
+	session.joinLiveStreams()
+	if actions := session.TakeLiveActions(); len(actions) != 0 {
+		t.Errorf("joined the same stream twice: %+v", actions)
+	}
+}
+
+func TestStartingATitleLeavesTheLiveStream(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 20, 0, 0, 0, time.UTC)
+	cfg := &config.Config{
+		StartTime:  start,
+		LiveEvents: []config.LiveEvent{{ID: "final", DurationMinutes: 90, JoinShare: 1, HeartbeatSeconds: 600}},
+	}
+	session := &Session{Rng: rand.New(rand.NewSource(1)), Config: cfg, Platform: &Platform{LiveStreams: newLiveStreams(cfg, nil)}, NextEventTime: start}
+	session.joinLiveStreams()
+
+	session.NextEventTime = start.Add(12 * time.Minute)
+	session.startPlayback(&catalog.Item{ID: "m", Runtime: time.Hour})
+	session.Finished = true
+	session.joinLiveStreams()
+	actions := session.TakeLiveActions()
+	if len(actions) != 3 || actions[2].Type != "leave" || !actions[2].Time.Equal(session.NextEventTime) {
+		t.Errorf("got %+v, want a join, a heartbeat and a leave when the title started", actions)
+	}
+}
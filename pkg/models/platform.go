@@ -0,0 +1,29 @@
+package models
+
+import (
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// Platform holds the simulation-wide services that every user and session share.
+type Platform struct {
+	AdServer    *AdServer
+	Catalog     catalog.Catalog    // the videos users can watch
+	LiveStreams []*LiveStream      // the scheduled live events
+	StateMap    *AuthLevelStateMap // the pages sessions move between
+}
+
+// NewPlatform builds the shared services, returning an error when the configured session
+// state machine is invalid.
+func NewPlatform(cfg *config.Config, videos catalog.Catalog) (*Platform, error) {
+	stateMap, err := InitializeStatesWithAuthLevel(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Platform{
+		AdServer:    NewAdServer(cfg),
+		Catalog:     videos,
+		LiveStreams: newLiveStreams(cfg, videos),
+		StateMap:    stateMap,
+	}, nil
+}
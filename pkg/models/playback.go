@@ -0,0 +1,305 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// defaultCompletionThreshold is the share of a title that counts as a complete watch when
+// the configuration does not set one.
+const defaultCompletionThreshold = 0.9
+
+// maxPlaybackActions bounds a playback plan, in case of a very short heartbeat interval.
+const maxPlaybackActions = 10000
+
+// PlaybackAction is something that happens while a viewer watches a title.
+type PlaybackAction struct {
+	Time     time.Time
+	Type     string        // start, heartbeat, pause, resume, seek, stop or complete
+	Position time.Duration // position in the title after the action
+	From     time.Duration // position before a seek
+	Paused   time.Duration // length of the pause a resume ends
+}
+
+// Playback is the plan of how a viewer watches a title, from pressing play to either
+// reaching the end or abandoning it part way through.
+type Playback struct {
+	Item     *catalog.Item
+	Actions  []PlaybackAction
+	Furthest time.Duration // furthest position reached
+	released int           // actions already reported
+	recorded bool          // the watch was checked for completion once the playback ended
+}
+
+// planPlayback plans how the viewer watches the item from start. The viewer abandons the
+// title at a constant rate per hour watched, lowered by their affinity for its genres, so
+// long titles and titles outside the viewer's taste are finished less often. Pauses and
+// seeks happen at their configured rates and heartbeats report the position while playing.
+func planPlayback(rng *rand.Rand, cfg config.PlaybackConfig, item *catalog.Item, start time.Time, affinity float64) *Playback {
+	p := &Playback{Item: item}
+	runtime := item.Runtime
+	now, position, watched := start, time.Duration(0), time.Duration(0)
+	p.add(PlaybackAction{Time: now, Type: "start"})
+
+	abandonAfter := time.Duration(math.MaxInt64)
+	if hazard := cfg.AbandonRate * (1 - cfg.AffinityWeight*affinity); hazard > 0 {
+		abandonAfter = hoursDuration(rng.ExpFloat64() / hazard)
+	}
+	heartbeat := time.Duration(cfg.HeartbeatSeconds) * time.Second
+	nextHeartbeat := time.Duration(math.MaxInt64)
+	if heartbeat > 0 {
+		nextHeartbeat = heartbeat
+	}
+	nextPause := poissonGap(rng, cfg.PauseRate)
+	nextSeek := poissonGap(rng, cfg.SeekRate)
+	maxSeek := int64(cfg.MaxSeekSeconds)
+	if maxSeek < 0 {
+		maxSeek = 0
+	}
+
+	for len(p.Actions) < maxPlaybackActions {
+		step := minDuration(runtime-position, abandonAfter-watched, nextHeartbeat, nextPause, nextSeek)
+		now = now.Add(step)
+		position += step
+		watched += step
+		nextHeartbeat -= step
+		nextPause -= step
+		nextSeek -= step
+
+		switch {
+		case position >= runtime:
+			p.add(PlaybackAction{Time: now, Type: "complete", Position: runtime})
+			return p
+		case watched >= abandonAfter:
+			p.add(PlaybackAction{Time: now, Type: "stop", Position: position})
+			return p
+		case nextPause <= 0:
+			p.add(PlaybackAction{Time: now, Type: "pause", Position: position})
+			paused := time.Duration(rng.ExpFloat64() * cfg.MeanPauseSeconds * float64(time.Second))
+			now = now.Add(paused)
+			p.add(PlaybackAction{Time: now, Type: "resume", Position: position, Paused: paused})
+			nextPause = poissonGap(rng, cfg.PauseRate)
+		case nextSeek <= 0:
+			from := position
+			offset := time.Duration(rng.Int63n(maxSeek+1)) * time.Second
+			if rng.Float64() < cfg.SeekBackChance {
+				position = maxDuration(position-offset, 0)
+			} else {
+				position = minDuration(position+offset, runtime)
+			}
+			p.add(PlaybackAction{Time: now, Type: "seek", Position: position, From: from})
+			nextSeek = poissonGap(rng, cfg.SeekRate)
+		default:
+			p.add(PlaybackAction{Time: now, Type: "heartbeat", Position: position})
+			nextHeartbeat = heartbeat
+		}
+	}
+	p.add(PlaybackAction{Time: now, Type: "stop", Position: position})
+	return p
+}
+
+func (p *Playback) add(action PlaybackAction) {
+	p.Actions = append(p.Actions, action)
+	if action.Position > p.Furthest {
+		p.Furthest = action.Position
+	}
+}
+
+// Started returns when the viewer pressed play.
+func (p *Playback) Started() time.Time {
+	return p.Actions[0].Time
+}
+
+// Ends returns when the viewer stops watching, at the end of the title or when abandoning it.
+func (p *Playback) Ends() time.Time {
+	return p.Actions[len(p.Actions)-1].Time
+}
+
+// Completed reports whether the viewer got far enough into the title for it to count as watched.
+func (p *Playback) Completed(threshold float64) bool {
+	if threshold <= 0 {
+		threshold = defaultCompletionThreshold
+	}
+	if p.Item.Runtime <= 0 {
+		return true
+	}
+	return float64(p.Furthest) >= threshold*float64(p.Item.Runtime)
+}
+
+// release returns the actions up to the given time that were not reported yet.
+func (p *Playback) release(until time.Time) []PlaybackAction {
+	start := p.released
+	for p.released < len(p.Actions) && !p.Actions[p.released].Time.After(until) {
+		p.released++
+	}
+	return p.Actions[start:p.released]
+}
+
+// stop cuts the plan short at the given time, ending it with a stop at the position the
+// viewer had reached. The cut off actions never happen.
+func (p *Playback) stop(at time.Time) {
+	if !p.Ends().After(at) {
+		return
+	}
+	kept := p.Actions[:0]
+	for _, action := range p.Actions {
+		if action.Time.After(at) {
+			break
+		}
+		kept = append(kept, action)
+	}
+	last := kept[len(kept)-1]
+	position := last.Position
+	if last.Type != "pause" {
+		position = minDuration(position+at.Sub(last.Time), p.Item.Runtime)
+	}
+	p.Actions = kept
+	if p.released > len(kept) {
+		p.released = len(kept)
+	}
+	p.Furthest = 0
+	for _, action := range kept {
+		if action.Position > p.Furthest {
+			p.Furthest = action.Position
+		}
+	}
+	p.add(PlaybackAction{Time: at, Type: "stop", Position: position})
+}
+
+// PercentComplete returns how far into the title the position is, in percent.
+func (p *Playback) PercentComplete(position time.Duration) float64 {
+	if p.Item.Runtime <= 0 {
+		return 100
+	}
+	return math.Round(1000*float64(position)/float64(p.Item.Runtime)) / 10
+}
+
+// genreAffinity returns how much the viewer likes the item's genres, from 0 for genres they
+// have no preference for to 1 for their favourite genre.
+func (s *Session) genreAffinity(item *catalog.Item) float64 {
+	favourite := 0.0
+	for _, preference := range s.GenrePreferences {
+		favourite = math.Max(favourite, preference)
+	}
+	if favourite <= 0 {
+		return 0
+	}
+	affinity := 0.0
+	for _, genre := range item.Genres {
+		affinity = math.Max(affinity, s.GenrePreferences[genre]/favourite)
+	}
+	return affinity
+}
+
+// startPlayback ends whatever is playing, a live stream included, and starts the item,
+// planning how it is watched.
+func (s *Session) startPlayback(item *catalog.Item) {
+	s.stopPlayback(s.NextEventTime)
+	if item != nil {
+		s.stopLive(s.NextEventTime)
+	}
+	s.CurrentMovie = item
+	if item == nil {
+		s.CurrentMovieEnd = time.Time{}
+		return
+	}
+	s.Playback = planPlayback(s.Rng, s.Config.Playback, item, s.NextEventTime, s.genreAffinity(item))
+	s.CurrentMovieEnd = s.Playback.Ends()
+}
+
+// stopPlayback ends the current playback at the given time if it still runs then, and
+// reports what happened up to that point.
+func (s *Session) stopPlayback(at time.Time) {
+	if s.Playback == nil {
+		return
+	}
+	s.Playback.stop(at)
+	s.releasePlayback(s.Playback.Ends())
+	s.Playback = nil
+}
+
+// releasePlayback collects the playback actions up to the given time for reporting. Once
+// the last action is released the title counts as watched if the viewer got far enough,
+// whichever page the session is on.
+func (s *Session) releasePlayback(until time.Time) {
+	p := s.Playback
+	if p == nil {
+		return
+	}
+	for _, action := range p.release(until) {
+		s.playbackActions = append(s.playbackActions, PlaybackReport{Playback: p, Action: action})
+	}
+	if p.released == len(p.Actions) && !p.recorded {
+		p.recorded = true
+		if p.Completed(s.Config.Playback.CompletionThreshold) {
+			s.completedWatches = append(s.completedWatches, p.Item)
+		}
+	}
+}
+
+// advancePlayback reports the playback actions up to the session's next event, pulling
+// the title first if its licence ran out. When the session finishes the viewer watches on
+// until the playback's planned end.
+func (s *Session) advancePlayback() {
+	until := s.NextEventTime
+	if s.Finished && s.CurrentMovieEnd.After(until) {
+		until = s.CurrentMovieEnd
+	}
+	s.checkRemoval(until)
+	s.releasePlayback(until)
+}
+
+// playbackCompleted reports whether the current title was watched far enough to count as
+// complete. Titles played without a plan count as complete.
+func (s *Session) playbackCompleted() bool {
+	return s.Playback == nil || s.Playback.Completed(s.Config.Playback.CompletionThreshold)
+}
+
+// PlaybackReport is a playback action waiting to be reported on the playback_events topic.
+type PlaybackReport struct {
+	Playback *Playback
+	Action   PlaybackAction
+}
+
+// TakePlaybackActions returns the playback actions that happened since the last call.
+func (s *Session) TakePlaybackActions() []PlaybackReport {
+	actions := s.playbackActions
+	s.playbackActions = nil
+	return actions
+}
+
+// poissonGap returns the watch time until the next event of a Poisson process with the
+// given rate per hour, or forever when the rate is not positive.
+func poissonGap(rng *rand.Rand, ratePerHour float64) time.Duration {
+	if ratePerHour <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return hoursDuration(rng.ExpFloat64() / ratePerHour)
+}
+
+func hoursDuration(hours float64) time.Duration {
+	if hours >= float64(math.MaxInt64)/float64(time.Hour) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(hours * float64(time.Hour))
+}
+
+func minDuration(first time.Duration, rest ...time.Duration) time.Duration {
+	for _, d := range rest {
+		if d < first {
+			first = d
+		}
+	}
+	return first
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
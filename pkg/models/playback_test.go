@@ -0,0 +1,109 @@
+package models
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func TestPlanPlaybackWatchesToTheEnd(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 20, 0, 0, 0, time.UTC)
+	item := &catalog.Item{ID: "m", Runtime: 90 * time.Minute}
+	cfg := config.PlaybackConfig{HeartbeatSeconds: 600}
+
+	p := planPlayback(rand.New(rand.NewSource(1)), cfg, item, start, 0)
+
+	if first := p.Actions[0]; first.Type != "start" || !first.Time.Equal(start) {
+		t.Fatalf("first action = %+v, want start at %v", first, start)
+	}
+	if last := p.Actions[len(p.Actions)-1]; last.Type != "complete" || last.Position != item.Runtime {
+		t.Fatalf("last action = %+v, want complete at the end", last)
+	}
+	if !p.Ends().Equal(start.Add(item.Runtime)) {
+		t.Errorf("ends at %v, want %v", p.Ends(), start.Add(item.Runtime))
+	}
+	heartbeats := 0
+	for _, action := range p.Actions {
+		if action.Type == "heartbeat" {
+			heartbeats++
+		}
+	}
+	if heartbeats != 8 {
+		t.Errorf("%d heartbeats, want 8", heartbeats)
+	}
+	if !p.Completed(0) {
+		t.Error("watching to the end should count as complete")
+	}
+}
+
+func TestPlanPlaybackAbandonsAndStops(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 20, 0, 0, 0, time.UTC)
+	item := &catalog.Item{ID: "m", Runtime: 3 * time.Hour}
+	cfg := config.PlaybackConfig{AbandonRate: 100}
+
+	p := planPlayback(rand.New(rand.NewSource(1)), cfg, item, start, 0)
+
+	last := p.Actions[len(p.Actions)-1]
+	if last.Type != "stop" || last.Position >= item.Runtime {
+		t.Fatalf("last action = %+v, want a stop part way through", last)
+	}
+	if p.Completed(0.9) {
+		t.Error("an abandoned title should not count as complete")
+	}
+
+	full := planPlayback(rand.New(rand.NewSource(1)), config.PlaybackConfig{HeartbeatSeconds: 60}, item, start, 0)
+	at := start.Add(30 * time.Minute)
+	full.stop(at)
+	if !full.Ends().Equal(at) || full.Furthest != 30*time.Minute {
+		t.Errorf("stopped playback ends at %v at %v, want %v at 30m", full.Ends(), full.Furthest, at)
+	}
+	for _, action := range full.Actions {
+		if action.Time.After(at) {
+			t.Fatalf("action %+v after the stop at %v", action, at)
+		}
+	}
+}
+
+func TestPlaybackRecordsCompletedWatchesWhenItEnds(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		playback config.PlaybackConfig
+		watches  int
+	}{
+		{"watched to the end", config.PlaybackConfig{HeartbeatSeconds: 600}, 1},
+		{"abandoned", config.PlaybackConfig{AbandonRate: 100}, 0},
+	}
+	for _, tt := range tests {
+		session := &Session{Rng: rand.New(rand.NewSource(1)), Config: &config.Config{Playback: tt.playback}, NextEventTime: start}
+		session.startPlayback(&catalog.Item{ID: "m", Runtime: 90 * time.Minute})
+
+		session.NextEventTime = start.Add(time.Minute)
+		session.advancePlayback()
+		if watches := session.TakeCompletedWatches(); len(watches) != 0 {
+			t.Fatalf("%s: recorded %d watches a minute in", tt.name, len(watches))
+		}
+		// the viewer browses other pages while the title plays out
+		for _, after := range []time.Duration{2 * time.Hour, 3 * time.Hour} {
+			session.NextEventTime = start.Add(after)
+			session.advancePlayback()
+		}
+		if watches := session.TakeCompletedWatches(); len(watches) != tt.watches {
+			t.Errorf("%s: recorded %d watches, want %d", tt.name, len(watches), tt.watches)
+		}
+	}
+}
+
+func TestPlanPlaybackIgnoresANegativeMaxSeek(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 20, 0, 0, 0, time.UTC)
+	item := &catalog.Item{ID: "m", Runtime: 90 * time.Minute}
+	p := planPlayback(rand.New(rand.NewSource(1)), config.PlaybackConfig{SeekRate: 10, MaxSeekSeconds: -30}, item, start, 0)
+	for _, action := range p.Actions {
+		if action.Type == "seek" && action.Position != action.From {
+			t.Fatalf("seek %+v moved, want seeks of nothing", action)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// Episode identifies an episode of a series. Seasons and episodes are numbered from 1.
+type Episode struct {
+	SeriesID string
+	Season   int
+	Number   int
+}
+
+// SeriesProgress records, for every series a user has started and not finished, the
+// episode they watch next. It is what a "continue watching" row shows.
+type SeriesProgress map[string]Episode
+
+// seriesID returns the ID a show is tracked by, falling back to its name.
+func seriesID(show *config.Show) string {
+	if show.ID != "" {
+		return show.ID
+	}
+	return show.Name
+}
+
+// nextEpisode returns the episode after ep, moving on to the next season after the last
+// episode of a season. ok is false once the series is finished.
+func nextEpisode(show *config.Show, ep Episode) (next Episode, ok bool) {
+	next = Episode{SeriesID: ep.SeriesID, Season: ep.Season, Number: ep.Number + 1}
+	for next.Season <= len(show.Seasons) {
+		if next.Number <= show.Seasons[next.Season-1] {
+			return next, true
+		}
+		next.Season++
+		next.Number = 1
+	}
+	return Episode{}, false
+}
+
+// episodeMovie describes an episode as the video the session plays.
+func episodeMovie(show *config.Show, ep Episode) *catalog.Item {
+	runtime := time.Duration(show.EpisodeMinutes) * time.Minute
+	if runtime <= 0 {
+		runtime = 30 * time.Minute
+	}
+	return &catalog.Item{
+		ID:      fmt.Sprintf("%s-s%02de%02d", ep.SeriesID, ep.Season, ep.Number),
+		Title:   fmt.Sprintf("%s S%02dE%02d", show.Name, ep.Season, ep.Number),
+		Type:    "tvEpisode",
+		Genres:  show.Genres,
+		Runtime: runtime,
+	}
+}
+
+// findShow returns the configured show with the given series ID.
+func (s *Session) findShow(id string) *config.Show {
+	for i := range s.Config.Shows {
+		if seriesID(&s.Config.Shows[i]) == id {
+			return &s.Config.Shows[i]
+		}
+	}
+	return nil
+}
+
+// startVideo picks what plays on a NextVideo page. When an episode was watched to the end
+// while the user was still watching, the next episode autoplays with the configured chance;
+// an episode the user gave up on stays where it is in their progress. Otherwise
+// the user resumes a series in progress with the binge probability, or picks new content:
+// a series, which continues where the user left it, or a movie.
+func (s *Session) startVideo(playedOut bool) {
+	series := s.Config.Series
+	if s.CurrentEpisode != nil {
+		finished := *s.CurrentEpisode
+		s.CurrentEpisode = nil
+		completed := s.playbackCompleted()
+		if completed {
+			s.finishEpisode(finished)
+		}
+		if next, ok := s.SeriesProgress[finished.SeriesID]; ok && completed && playedOut && s.Rng.Float64() < series.Autoplay {
+			s.startEpisode(next)
+			return
+		}
+	}
+	if s.Rng.Float64() < series.BingeProbability {
+		if next, ok := s.resumableEpisode(); ok {
+			s.startEpisode(next)
+			return
+		}
+	}
+	if s.Rng.Float64() < series.ShowShare {
+		if show := s.nextShow(); show != nil {
+			id := seriesID(show)
+			next, ok := s.SeriesProgress[id]
+			if !ok {
+				next = Episode{SeriesID: id, Season: 1, Number: 1}
+			}
+			s.startEpisode(next)
+			return
+		}
+	}
+	s.startMovie()
+}
+
+// startEpisode plays the episode and records it as where the user is in the series.
+func (s *Session) startEpisode(ep Episode) {
+	show := s.findShow(ep.SeriesID)
+	if show == nil {
+		s.startMovie()
+		return
+	}
+	if s.SeriesProgress == nil {
+		s.SeriesProgress = make(SeriesProgress)
+	}
+	s.CurrentEpisode = &ep
+	s.SeriesProgress[ep.SeriesID] = ep
+	s.startPlayback(episodeMovie(show, ep))
+}
+
+// finishEpisode moves the user's progress past an episode they watched, dropping the
+// series from their progress once its last episode is done.
+func (s *Session) finishEpisode(ep Episode) {
+	show := s.findShow(ep.SeriesID)
+	if show == nil {
+		delete(s.SeriesProgress, ep.SeriesID)
+		return
+	}
+	if next, ok := nextEpisode(show, ep); ok {
+		s.SeriesProgress[ep.SeriesID] = next
+	} else {
+		delete(s.SeriesProgress, ep.SeriesID)
+	}
+}
+
+// resumableEpisode picks one of the series in progress that the subscription tier can watch.
+func (s *Session) resumableEpisode() (Episode, bool) {
+	ids := make([]string, 0, len(s.SeriesProgress))
+	for id := range s.SeriesProgress {
+		if show := s.findShow(id); show != nil && s.tierAllowsShow(show) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return Episode{}, false
+	}
+	sort.Strings(ids) // fixed order keeps seeded runs reproducible
+	return s.SeriesProgress[ids[s.Rng.Intn(len(ids))]], true
+}
+
+// nextShow samples a show by its configured weight among the shows the tier can watch.
+func (s *Session) nextShow() *config.Show {
+	shows := make([]*config.Show, 0, len(s.Config.Shows))
+	weights := make([]float64, 0, len(s.Config.Shows))
+	for i := range s.Config.Shows {
+		show := &s.Config.Shows[i]
+		if len(show.Seasons) == 0 || !s.tierAllowsShow(show) {
+			continue
+		}
+		shows = append(shows, show)
+		weights = append(weights, float64(show.Weight))
+	}
+	show, _ := weightedRandomSelect(s.Rng, shows, weights)
+	return show
+}
+
+// tierAllowsShow reports whether the show has a genre in the subscription tier's catalog.
+// Shows without genres are in every catalog.
+func (s *Session) tierAllowsShow(show *config.Show) bool {
+	allowed := s.tierConfig().Genres
+	if len(allowed) == 0 || len(show.Genres) == 0 {
+		return true
+	}
+	for _, genre := range show.Genres {
+		if containsFold(allowed, genre) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func TestNextEpisodeCrossesSeasonsAndEnds(t *testing.T) {
+	show := &config.Show{ID: "s", Seasons: []int{2, 1}}
+	steps := []Episode{{"s", 1, 1}, {"s", 1, 2}, {"s", 2, 1}}
+	for i := 0; i < len(steps)-1; i++ {
+		next, ok := nextEpisode(show, steps[i])
+		if !ok || next != steps[i+1] {
+			t.Fatalf("episode after %+v is %+v (ok %v), want %+v", steps[i], next, ok, steps[i+1])
+		}
+	}
+	if next, ok := nextEpisode(show, steps[len(steps)-1]); ok {
+		t.Errorf("series should be finished, got %+v", next)
+	}
+}
+
+func TestStartVideoAutoplaysAndContinuesAcrossSessions(t *testing.T) {
+	cfg := &config.Config{
+		Shows:  []config.Show{{ID: "s", Name: "Show", Weight: 1, Seasons: []int{3}, EpisodeMinutes: 20}},
+		Series: config.SeriesConfig{ShowShare: 1, Autoplay: 1},
+	}
+	progress := make(SeriesProgress)
+	session := &Session{Rng: rand.New(rand.NewSource(1)), Config: cfg, SeriesProgress: progress, NextEventTime: time.Unix(0, 0)}
+
+	session.startVideo(false)
+	session.startVideo(true)
+	if ep := session.CurrentEpisode; ep == nil || ep.Number != 2 {
+		t.Fatalf("autoplay should play episode 2, playing %+v", ep)
+	}
+	if got := session.CurrentMovieEnd.Sub(session.NextEventTime); got != 20*time.Minute {
+		t.Errorf("episode runs %v, want 20m", got)
+	}
+
+	// a new session picks the show up again at the episode the user did not finish
+	next := &Session{Rng: session.Rng, Config: cfg, SeriesProgress: progress}
+	next.startVideo(false)
+	if ep := next.CurrentEpisode; ep == nil || ep.Number != 2 {
+		t.Errorf("next session should continue with episode 2, playing %+v", ep)
+	}
+}
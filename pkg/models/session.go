@@ -8,16 +8,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
 	"github.com/chrisdamba/simstreamdata/pkg/config"
 )
 
-type ContentType string 
-
-const (
-    Audio   ContentType = "audio"
-    VideoType   ContentType = "video"
-)
-
 type SubscriptionType string
 
 const (
@@ -29,18 +23,11 @@ const (
 type Ad struct {
     ID        string
     Type      string 
+    Campaign  string
     Duration  time.Duration
     StartTime time.Time
 }
 
-type Content struct {
-    ID          string
-    Type        ContentType
-    Duration    time.Duration 
-    Breakpoints []time.Duration // Mid-roll ads breakpoints for video
-    StartTime   time.Time
-}
-
 type Session struct {
     ID              int64
     StartTime       time.Time 
@@ -51,31 +38,49 @@ type Session struct {
     Auth            string // Auth
     Level           string // Level
     ItemInSession   int     // ItemInSession
+    levelChanged    bool    // the level changed mid-session, so the next state comes from the new level's generator
 
     CurrentState    *State
     PreviousState   *State
+    history         []string // pages viewed before the current one, the most recent last, for history transitions
     StateMachine    *StateMachine
     StateMap        *AuthLevelStateMap
 
-    CurrentContent  *Content  
     CurrentAd       *Ad 
-    CurrentVideo    *config.Video
-    CurrentMovie    *config.Movie
+    CurrentMovie    *catalog.Item
     CurrentMovieEnd time.Time
-    VideoEndTime    time.Time
+    CurrentEpisode  *Episode // set while the current video is an episode of a series
+    Playback        *Playback // how the current video is watched
+    playbackActions []PlaybackReport // playback actions not yet reported on the playback_events topic
+    CurrentSong     *config.Song
+    CurrentSongEnd  time.Time // when the song ends or, if it is skipped, when the listener skips it
     
     // State tracking
     NextEventTime   time.Time
     NextEventType   string  // "Content", "AdStart", "AdImpression", "AdComplete" 
     NextEventNumber int // Add NextEventNumber field to track the number of events in the session
     LastAdTime      time.Time
+    AdsInSession    int
+    AdHistory       *AdHistory // shared with the user's other sessions for frequency capping
+    adDecisions     []AdDecision // auction outcomes not yet reported on the ad_requests topic
+    removals        []Removal    // titles pulled while playing, not yet reported as error pages
+    completedWatches []*catalog.Item // movies watched to the end that the user has not learned from yet
+    liveActions     []LiveAction // live stream actions not yet reported on the live_events topic
+    liveViewing     []LiveAction // planned actions of the live stream being watched that have not happened yet
+    authLevelChanges []AuthLevelChange // upgrades and downgrades taken, not yet reported
 
     // User-related (for ad logic)
     SubscriptionTier SubscriptionType
+    DeviceType       string
+    Region           string // the user's region, which decides the titles they can watch
     EngagementLevel  int
     Finished         bool
     Rng             *rand.Rand
 	Config          *config.Config
+    Platform        *Platform
+    GenrePreferences map[string]float64 // shared with the user, so preference changes carry across sessions
+    SeriesProgress   SeriesProgress     // shared with the user, so series continue across sessions
+    LiveDecisions    map[string]bool    // live events the user has decided whether to watch, shared with the user
 }
 
 // SessionIDCounter holds the current count for session IDs.
@@ -90,96 +95,317 @@ func NextSessionID() int64 {
     return sessionIDCounter
 }
 
-func NewSession(nextEventTime time.Time, alpha float64, beta float64, stateMap *AuthLevelStateMap, auth string, level string, rng *rand.Rand, cfg *config.Config) *Session {
-    var currentMovie *config.Movie
-    var currentMovieEnd time.Time
+func NewSession(nextEventTime time.Time, alpha float64, beta float64, stateMap *AuthLevelStateMap, auth string, level string, tier SubscriptionType, rng *rand.Rand, cfg *config.Config, platform *Platform) *Session {
     currentState := stateMap.GetRandomState(auth, level, rng)
-    if currentState.Page == "NextVideo" {
-        currentMovie = cfg.NextMovie() 
-        currentMovieEnd = nextEventTime.Add(currentMovie.RuntimeMinutes)
-    } else {
-        currentMovie = nil 
-        currentMovieEnd = time.Time{}
-    }
-
 
     return &Session{
         ID: NextSessionID(),
+        StartTime: nextEventTime,
         Alpha: alpha,
         Beta: beta,
         Auth: auth,
         Level: level,
+        SubscriptionTier: tier,
         StateMap:     stateMap,
         CurrentState: currentState,
         NextEventTime: nextEventTime,
 		Rng: rng,
 		Config: cfg,
+        Platform: platform,
         Finished: false,
-        CurrentMovie: currentMovie,
-        CurrentMovieEnd: currentMovieEnd,
         ItemInSession: 0,
     }
 }
 
+// startContent starts playback when the session opens on a content page, and lets the user
+// tune in to a live event under way. It runs once the user's preferences are attached to the
+// session, as they drive what gets played.
+func (s *Session) startContent() {
+    switch s.CurrentState.Page {
+    case "NextVideo":
+        s.startVideo(false)
+    case "NextSong":
+        s.startSong()
+    }
+    s.joinLiveStreams()
+}
+
 
 func (s *Session) NextSession() *Session {
     nextEventTime := s.PickNextSessionStartTime(s.NextEventTime, s.Beta)
 
-    nextSession := NewSession(nextEventTime, s.Alpha, s.Beta, s.StateMap, s.Auth, s.Level, s.Rng, s.Config)
+    nextSession := NewSession(nextEventTime, s.Alpha, s.Beta, s.StateMap, s.Auth, s.Level, s.SubscriptionTier, s.Rng, s.Config, s.Platform)
+    nextSession.AdHistory = s.AdHistory
+    nextSession.DeviceType = s.DeviceType
+    nextSession.Region = s.Region
+    nextSession.GenrePreferences = s.GenrePreferences
+    nextSession.SeriesProgress = s.SeriesProgress
+    nextSession.LiveDecisions = s.LiveDecisions
+    nextSession.startContent()
     return nextSession
 }
 
 func (s *Session) IncrementEvent() {
-    nextState := s.CurrentState.GetNextState(s.Rng)
+    if s.CurrentState.Page == "AdStart" && s.abandonsForAdFatigue() {
+        s.Finished = true
+        return
+    }
+    defer s.advancePlayback()
+    defer s.joinLiveStreams()
+    defer s.followAuthLevel(s.CurrentState)
+    defer s.recordHistory(s.CurrentState, s.ItemInSession)
+    var nextState *State
+    if s.levelChanged {
+        s.levelChanged = false
+        // follow a configured transition into the new level, if the page has one
+        if next := s.CurrentState.After(s.history).GetNextStateInContext(s.Rng, s.transitionContext(), s.blockedPages()); next != nil && next.UserLevel == s.Level {
+            nextState = next
+        } else {
+            nextState = s.StateMap.GetRandomState(s.Auth, s.Level, s.Rng)
+        }
+    }
+    if nextState == nil {
+        nextState = s.CurrentState.After(s.history).GetNextStateInContext(s.Rng, s.transitionContext(), s.blockedPages())
+    }
+    songEnded := nextState != nil && s.finishSong()
     switch {
         case nextState == nil:
             fmt.Println("Next state is nil, marking session as finished.")
             s.Finished = true
         case nextState.StatusCode >= 300 && nextState.StatusCode <= 399:
             fmt.Println("Status code is within the range [300, 399].")
-            s.NextEventTime = s.NextEventTime.Add(time.Second)
+            if !songEnded {
+                s.NextEventTime = s.NextEventTime.Add(s.dwell(s.CurrentState))
+            }
             s.CurrentState = nextState
             s.ItemInSession += 1
         case nextState.Page == "NextVideo":
             fmt.Println("Transitioning to NextVideo state.")
-            if s.CurrentMovie == nil {
-                fmt.Println("Starting a new movie.")
-                seconds := exponentialRandomValue(s.Rng, s.Alpha)
-                s.NextEventTime = s.NextEventTime.Add(time.Duration(seconds))
-            } else if s.NextEventTime.Before(s.CurrentMovieEnd) {
+            playedOut := s.CurrentMovie != nil && s.NextEventTime.Before(s.CurrentMovieEnd) && !s.checkRemoval(s.CurrentMovieEnd)
+            if playedOut {
                 fmt.Println("Current movie has not ended yet.")
                 s.NextEventTime = s.CurrentMovieEnd
-                s.CurrentMovie = s.Config.NextMovie()
-            } else {
-                fmt.Println("Current movie has ended. Starting a new movie.")
-                seconds := exponentialRandomValue(s.Rng, s.Alpha)
-                s.NextEventTime = s.NextEventTime.Add(time.Duration(seconds))
-                s.CurrentMovie = s.Config.NextMovie()
+            } else if !songEnded {
+                fmt.Println("Starting a new movie.")
+                s.NextEventTime = s.NextEventTime.Add(s.dwell(s.CurrentState))
+            }
+            s.startVideo(playedOut)
+            s.CurrentState = nextState
+            s.ItemInSession += 1
+        case nextState.Page == "NextSong":
+            if !songEnded {
+                s.NextEventTime = s.NextEventTime.Add(s.dwell(s.CurrentState))
             }
-            s.CurrentMovieEnd = s.NextEventTime.Add(s.CurrentMovie.RuntimeMinutes)
-            s.PreviousState = s.CurrentState
+            s.startSong()
             s.CurrentState = nextState
             s.ItemInSession += 1
         case nextState.Page == "AdStart":
             fmt.Println("Starting an advertisement.")
-            s.startAd()
+            if !s.startAd() {
+                if !songEnded {
+                    s.NextEventTime = s.NextEventTime.Add(s.dwell(s.CurrentState))
+                }
+                return
+            }
+            s.CurrentState = nextState
+            s.ItemInSession += 1
     
         case nextState.Page == "AdImpression":
             fmt.Println("Recording an ad impression.")
             s.scheduleNextAdImpression()
+            s.CurrentState = nextState
+            s.ItemInSession += 1
     
         case nextState.Page == "AdEnd":
             fmt.Println("Ad has completed.")
             s.finishAdAndResumeContent()
+            s.CurrentState = nextState
+            s.ItemInSession += 1
         default:
             fmt.Println("Default case.")
-            seconds := exponentialRandomValue(s.Rng, s.Alpha)
-            s.NextEventTime = s.NextEventTime.Add(time.Duration(seconds))
+            if !songEnded {
+                s.NextEventTime = s.NextEventTime.Add(s.dwell(s.CurrentState))
+            }
             s.CurrentState = nextState
             s.ItemInSession += 1
 	}
 }
 
+// recordHistory remembers the page the session was on when it moved to a new page view.
+func (s *Session) recordHistory(from *State, item int) {
+    if s.ItemInSession == item || from == nil {
+        return
+    }
+    s.PreviousState = from
+    if s.StateMap == nil || s.StateMap.HistoryLength == 0 {
+        return
+    }
+    s.history = append(s.history, from.Page)
+    if extra := len(s.history) - s.StateMap.HistoryLength; extra > 0 {
+        s.history = s.history[extra:]
+    }
+}
+
+// AuthLevelChange records the session taking an upgrade or downgrade transition.
+type AuthLevelChange struct {
+    Time     time.Time
+    Type     string // upgrade or downgrade
+    OldAuth  string
+    NewAuth  string
+    OldLevel string
+    NewLevel string
+}
+
+// followAuthLevel moves the session to the auth and level of the state it entered when it
+// got there from the given state by an upgrade or downgrade transition.
+func (s *Session) followAuthLevel(from *State) {
+    to := s.CurrentState
+    if from == nil || to == nil || to == from {
+        return
+    }
+    kind := from.TransitionType(to)
+    if kind == "lateral" {
+        return
+    }
+    change := AuthLevelChange{Time: s.NextEventTime, Type: kind, OldAuth: s.Auth, NewAuth: to.AuthStatus, OldLevel: s.Level, NewLevel: to.UserLevel}
+    if change.NewAuth == "" {
+        change.NewAuth = s.Auth
+    }
+    if change.NewLevel == "" {
+        change.NewLevel = s.Level
+    }
+    if change.NewAuth == change.OldAuth && change.NewLevel == change.OldLevel {
+        return
+    }
+    s.Auth = change.NewAuth
+    s.Level = change.NewLevel
+    s.authLevelChanges = append(s.authLevelChanges, change)
+}
+
+// TakeAuthLevelChanges returns the auth and level changes since the last call.
+func (s *Session) TakeAuthLevelChanges() []AuthLevelChange {
+    changes := s.authLevelChanges
+    s.authLevelChanges = nil
+    return changes
+}
+
+// ChangeSubscription moves the session to a new tier. When the tier maps to a different
+// level the session continues from that level's pages in the AuthLevelStateMap.
+func (s *Session) ChangeSubscription(tier SubscriptionType, level string) {
+    s.SubscriptionTier = tier
+    if level != "" && level != s.Level {
+        s.Level = level
+        s.levelChanged = true
+    }
+}
+
+// startMovie picks the next movie for the session and plays it.
+func (s *Session) startMovie() {
+    s.startPlayback(s.nextMovie())
+}
+
+// nextMovie samples a genre by the user's genre preferences, limited to the genres the
+// subscription tier can watch, then a movie of that genre weighted by its popularity.
+// Genres the user has no preference for keep a small weight so they can still be found,
+// and with the configured novelty-seeking chance the user ignores their preferences altogether.
+func (s *Session) nextMovie() *catalog.Item {
+    videos := s.catalog()
+    if videos == nil {
+        return nil
+    }
+    exploring := s.Rng.Float64() < s.Config.Taste.NoveltySeeking
+    allowed := s.tierConfig().Genres
+    var genres []string
+    for _, genre := range videos.Genres() { // sorted, which keeps seeded runs reproducible
+        if len(allowed) == 0 || containsFold(allowed, genre) {
+            genres = append(genres, genre)
+        }
+    }
+    weights := make([]float64, len(genres))
+    for i, genre := range genres {
+        weights[i] = 1.0
+        if preference, ok := s.GenrePreferences[genre]; ok && preference > 0 && !exploring {
+            weights[i] = preference
+        }
+    }
+    genre, ok := weightedRandomSelect(s.Rng, genres, weights)
+    if !ok {
+        return nil
+    }
+    return videos.SamplePopular(s.Rng, catalog.Query{Genre: genre, At: s.NextEventTime, Region: s.Region})
+}
+
+// catalog returns the video catalog of the platform, or nil when none is loaded.
+func (s *Session) catalog() catalog.Catalog {
+    if s.Platform == nil {
+        return nil
+    }
+    return s.Platform.Catalog
+}
+
+// startSong plays the next track from the audio catalog. The track either plays to the end
+// or, with the configured skip probability, is skipped part way through, and the next
+// NextSong event is due at that point.
+func (s *Session) startSong() {
+    s.CurrentSong = s.Config.NextSong()
+    if s.CurrentSong == nil {
+        s.CurrentSongEnd = time.Time{}
+        return
+    }
+    listened := s.CurrentSong.Duration
+    audio := s.Config.Audio
+    if s.Rng.Float64() < audio.SkipProbability {
+        minListen := time.Duration(audio.MinListen) * time.Second
+        if minListen < listened {
+            listened = minListen + time.Duration(s.Rng.Int63n(int64(listened-minListen)))
+        }
+    }
+    s.CurrentSongEnd = s.NextEventTime.Add(listened)
+}
+
+// finishSong moves the clock to the end of the playing song, or to where the listener skips
+// it, and reports whether a song was still playing. The next page view happens then,
+// whichever page it is.
+func (s *Session) finishSong() bool {
+    if s.CurrentSong == nil || !s.NextEventTime.Before(s.CurrentSongEnd) {
+        return false
+    }
+    s.NextEventTime = s.CurrentSongEnd
+    return true
+}
+
+// tierConfig returns the configuration of the session's subscription tier. Tiers that are
+// not configured see the whole catalog and every ad, as all users did before tiers existed.
+func (s *Session) tierConfig() config.SubscriptionTier {
+    if tier, ok := s.Config.Tier(string(s.SubscriptionTier)); ok {
+        return tier
+    }
+    return config.SubscriptionTier{Name: string(s.SubscriptionTier), AdLoad: 1}
+}
+
+// blockedPages returns the pages the session's subscription tier cannot transition to.
+func (s *Session) blockedPages() map[string]bool {
+    pages := s.tierConfig().BlockedPages
+    if len(pages) == 0 {
+        return nil
+    }
+    blocked := make(map[string]bool, len(pages))
+    for _, page := range pages {
+        blocked[page] = true
+    }
+    return blocked
+}
+
+// transitionContext describes the session for the transition overrides of its next move.
+func (s *Session) transitionContext() *TransitionContext {
+    return &TransitionContext{
+        Time:          s.NextEventTime,
+        Device:        s.DeviceType,
+        Tier:          string(s.SubscriptionTier),
+        ItemInSession: s.ItemInSession,
+    }
+}
+
 // exponentialRandomValue returns a random value drawn from an exponential distribution with mean mu.
 // This version uses a local RNG for better reproducibility and safety across different packages.
 func exponentialRandomValue(rng *rand.Rand, mu float64) float64 {
@@ -188,211 +414,158 @@ func exponentialRandomValue(rng *rand.Rand, mu float64) float64 {
 	return -mu * math.Log(1-rng.Float64())
 }
 
-func (s *Session) startAd() {
+// startAd runs the ad decision for the slot and plays the winning campaign's ad.
+// It returns false when the tier skips the slot or the auction produces no fill.
+func (s *Session) startAd() bool {
+    if s.Rng.Float64() >= s.tierConfig().AdLoad {
+        return false // the subscription tier does not show an ad in this slot
+    }
+    decision := s.decideAd()
+    if !decision.Filled {
+        return false
+    }
     adDuration := 30 * time.Second // Example ad duration
     adID := fmt.Sprintf("Ad-%d", s.Rng.Int())
+    startTime := s.NextEventTime
     s.CurrentAd = &Ad{
         ID:        adID,
         Type:      "Standard",
+        Campaign:  decision.Campaign,
         Duration:  adDuration,
-        StartTime: time.Now(),
+        StartTime: startTime,
     }
     s.NextEventType = "AdImpression"
-    s.NextEventTime = time.Now().Add(adDuration)
-    s.LastAdTime = time.Now()    // Update the last ad time
+    s.NextEventTime = startTime.Add(adDuration)
+    s.LastAdTime = startTime    // Update the last ad time
+    s.AdsInSession++
+    if s.AdHistory != nil {
+        s.AdHistory.Record(decision.Campaign, startTime)
+    }
 
 	// Log the ad start for debugging.
-	log.Printf("Starting Standard ad at %v, ID: %s\n", s.NextEventTime, adID)
+	log.Printf("Starting Standard ad at %v, ID: %s, campaign: %s\n", s.NextEventTime, adID, decision.Campaign)
+    return true
 }
 
-func (s *Session) scheduleNextAdImpression() {
-    // Simulating ad impression intervals and optionally ending the ad.
-    if rand.Float64() < 0.8 { // Example probability to continue ad impressions
-        s.NextEventTime = time.Now().Add(5 * time.Second) // Next impression
+// decideAd asks the ad server to fill the slot, targeting the content being watched,
+// the user's tier and device, and skipping campaigns the user is frequency capped on.
+func (s *Session) decideAd() AdDecision {
+    req := AdRequest{
+        Time:   s.NextEventTime,
+        Tier:   s.SubscriptionTier,
+        Device: s.DeviceType,
+    }
+    if s.CurrentMovie != nil {
+        req.Genres = s.CurrentMovie.Genres
+    }
+    var decision AdDecision
+    if s.Platform != nil && s.Platform.AdServer != nil {
+        decision = s.Platform.AdServer.Decide(req, func(c config.AdCampaign) bool {
+            return s.AdHistory == nil || s.AdHistory.CanServe(c, req.Time, s.Config.AdConfig.MaxAdsPerDay)
+        })
     } else {
-        s.NextEventTime = time.Now().Add(5 * time.Second) // End of ad
-        s.NextEventType = "AdEnd"
+        decision = AdDecision{Time: req.Time, NoFillReason: "no-ad-server"}
     }
+    s.adDecisions = append(s.adDecisions, decision)
+    return decision
 }
 
-func (s *Session) finishAdAndResumeContent() {
-    s.CurrentAd = nil // Clear the ad
-    s.NextEventType = "NextVideo" // Resume video playback
-    s.NextEventTime = time.Now().Add(1 * time.Minute) // Example delay before next content
+// TakeAdDecisions returns the ad decisions made since the last call.
+func (s *Session) TakeAdDecisions() []AdDecision {
+    decisions := s.adDecisions
+    s.adDecisions = nil
+    return decisions
 }
 
-
-
-
-
-
-
-
-func (s *Session) IncrementEvent_Old() {
-    now := time.Now()
-
-    	// Check if it's time for the next event
-	if now.After(s.NextEventTime) {
-		nextState := s.CurrentState.GetNextState(s.Rng)
-		if nextState == nil {
-			s.Finished = true // No more transitions available
-			return
-		}
-		s.handleTransition(nextState)
-	}
+// Removal records a title that stopped being available in the user's region while it played.
+type Removal struct {
+    Item   *catalog.Item
+    Time   time.Time
+    Status int // 451 when the title is still licensed elsewhere, 404 when it left the catalog
 }
 
-// handleTransition updates session based on the state transition
-func (s *Session) handleTransition(nextState *State) {
-	s.CurrentState = nextState
-
-	switch s.CurrentState.Page {
-        case "PlayVideo", "NextSong":
-            s.handleContent()
-        case "AdStart", "AdImpression", "AdEnd":
-            s.handleAdEvent()
-        default:
-            nState := nextState.GetNextState(s.Rng)
-            s.scheduleNextEvent(nState.Page)
-	}
+// checkRemoval stops playback when the playing title's licence in the user's region ends
+// before both the title and the given time, and records the error page the user is shown
+// at that moment. It reports whether the title was pulled.
+func (s *Session) checkRemoval(until time.Time) bool {
+    item := s.CurrentMovie
+    if item == nil || len(item.Licenses) == 0 {
+        return false
+    }
+    started := s.CurrentMovieEnd.Add(-item.Runtime)
+    if s.Playback != nil {
+        started = s.Playback.Started()
+    }
+    end := item.AvailableUntil(s.Region, started)
+    if end.IsZero() || !end.Before(s.CurrentMovieEnd) || end.After(until) {
+        return false
+    }
+    status := 404
+    if item.AvailableIn("", end) {
+        status = 451
+    }
+    s.removals = append(s.removals, Removal{Item: item, Time: end, Status: status})
+    s.stopPlayback(end)
+    s.CurrentMovie = nil
+    s.CurrentMovieEnd = time.Time{}
+    if end.After(s.NextEventTime) {
+        s.NextEventTime = end
+    }
+    return true
 }
 
-// handleContent simulates handling different content types
-func (s *Session) handleContent() {
-	if s.CurrentState.Page == "NextSong" && s.CurrentContent != nil && s.CurrentContent.Type == Audio {
-		// Simulate time till next song
-		nextDuration := time.Duration(s.Rng.ExpFloat64()*float64(s.Config.Alpha)) * time.Second
-		s.scheduleNextEventAt("NextSong", nextDuration)
-	}
-	if s.CurrentState.Page == "PlayVideo" && s.CurrentContent != nil && s.CurrentContent.Type == VideoType {
-		// Check and handle mid-roll ad insertion
-		if s.shouldInsertMidRollAd(s.Config) {
-			s.startAdSequence("mid-roll")
-			return
-		}
-		nextDuration := time.Duration(s.Rng.ExpFloat64()*float64(s.Config.Alpha)) * time.Second
-		s.scheduleNextEventAt("PlayVideo", nextDuration)
-	}
+// TakeRemovals returns the titles pulled during playback since the last call.
+func (s *Session) TakeRemovals() []Removal {
+    removals := s.removals
+    s.removals = nil
+    return removals
 }
 
-// handleAdEvent manages transitions related to advertising
-func (s *Session) handleAdEvent() {
-	// Define ad handling logic
-	switch s.NextEventType {
-        case "AdStart", "":
-            // Move to AdImpression
-            s.CurrentAd.StartTime = time.Now()
-            s.NextEventType = "AdImpression"
-            s.NextEventTime = time.Now().Add(time.Duration(s.Rng.Intn(10)+1) * time.Second) // Ad impressions occur shortly after ad starts
-        case "AdImpression":
-            // Transition logic for ad impressions
-            s.scheduleNextAdImpression()
-        case "AdComplete":
-            // Finish the ad sequence and resume content
-            s.finishAdAndResumeContent()
-	}
-	s.scheduleNextEvent(s.NextEventType)
+// TakeCompletedWatches returns the movies watched to the end since the last call.
+func (s *Session) TakeCompletedWatches() []*catalog.Item {
+    watches := s.completedWatches
+    s.completedWatches = nil
+    return watches
 }
 
+// abandonsForAdFatigue decides whether the user drops the session after an ad.
+// The chance grows by FatigueFactor with every ad already shown in the session.
+func (s *Session) abandonsForAdFatigue() bool {
+    p := s.Config.AdConfig.FatigueFactor * float64(s.AdsInSession)
+    return p > 0 && s.Rng.Float64() < math.Min(p, 1)
+}
 
-func (s *Session) scheduleNextAdImpression_Old() {
-    // Move to AdComplete or next AdImpression
-    if s.Rng.Float64() < 0.8 { // 80% chance to go to next impression
-        s.NextEventType = "AdImpression"
-        s.NextEventTime = time.Now().Add(time.Duration(s.Rng.Intn(10)+1) * time.Second)
+func (s *Session) scheduleNextAdImpression() {
+    // Simulating ad impression intervals and optionally ending the ad.
+    if s.Rng.Float64() < 0.8 { // Example probability to continue ad impressions
+        s.NextEventTime = s.NextEventTime.Add(5 * time.Second) // Next impression
     } else {
-        s.NextEventType = "AdComplete"
-        s.NextEventTime = time.Now().Add(time.Duration(s.Rng.Intn(5)+1) * time.Second)
+        s.NextEventTime = s.NextEventTime.Add(5 * time.Second) // End of ad
+        s.NextEventType = "AdEnd"
     }
 }
 
-func (s *Session) HandleNextVideoEvent(config *config.Config) {
-    currentTime := time.Since(s.CurrentContent.StartTime)
-
-    // Check for pre-roll ad first
-    if currentTime < config.AdConfig.PreRollCooldown && s.shouldInsertPreRollAd(config) {
-        s.startAdSequence("pre-roll")
-        return
-    }
-
-    // Check for mid-roll ads
-    if s.shouldInsertMidRollAd(config) {
-        s.startAdSequence("mid-roll")
-        return
-    }
-
-    // If no ads are to be inserted, schedule the next content event
-    s.scheduleNextEvent("PlayVideo")
+func (s *Session) finishAdAndResumeContent() {
+    s.CurrentAd = nil // Clear the ad
+    s.NextEventType = "NextVideo" // Resume video playback
+    s.NextEventTime = s.NextEventTime.Add(1 * time.Minute) // Example delay before next content
 }
 
 
 
-// startAdSequence initializes an ad sequence based on the ad type (pre-roll or mid-roll).
-func (s *Session) startAdSequence(adType string) {
-	// Generate an ad ID and determine the ad duration based on type.
-	adID := fmt.Sprintf("Ad-%d", s.Rng.Int())
-	adDuration := 30 * time.Second // Simplified example: 30-second ads
-
-	// Update the session to reflect the ad start.
-	s.CurrentAd = &Ad{
-		ID:        adID,
-		Type:      adType,
-		Duration:  adDuration,
-		StartTime: time.Now(),
-	}
-
-	// Set the next event type to "AdStart" and schedule it immediately.
-	s.NextEventType = "AdStart"
-	s.NextEventTime = time.Now()
-    s.LastAdTime = time.Now()    // Update the last ad time
-
-	// Log the ad start for debugging.
-	log.Printf("Starting %s ad at %v, ID: %s\n", adType, s.NextEventTime, adID)
-}
-
-
 
-// scheduleNextEvent schedules the next event based on the event type
-func (s *Session) scheduleNextEvent(eventType string) {
-	interval := time.Duration(s.Rng.Intn(5)+1) * time.Minute
-	s.NextEventTime = time.Now().Add(interval)
-	s.NextEventType = eventType
-}
 
-// scheduleNextEventAt schedules the next event at a specific time interval
-func (s *Session) scheduleNextEventAt(eventType string, duration time.Duration) {
-	s.NextEventTime = time.Now().Add(duration)
-	s.NextEventType = eventType
-}
 
-// shouldInsertPreRollAd checks if a pre-roll ad should be inserted
-func (s *Session) shouldInsertPreRollAd(config *config.Config) bool {
-    if time.Since(s.LastAdTime) >= config.AdConfig.PreRollCooldown && rand.Float64() < config.AdConfig.PreRollFrequency {
-        s.LastAdTime = time.Now() // Update the last ad time to now
-        return true
-    }
-    return false
-}
 
-// shouldInsertMidRollAd checks if a mid-roll ad should be inserted based on breakpoints
-func (s *Session) shouldInsertMidRollAd(config *config.Config) bool {
-    currentTime := time.Since(s.CurrentContent.StartTime)
-    for _, bp := range s.CurrentContent.Breakpoints {
-        if currentTime > bp && currentTime-bp < config.AdConfig.MidRollWindow {
-            return true
-        }
-    }
-    return false
-}
 
 func (s *Session) IsDone() bool {
     // Check if the session should be considered done
     // The session is considered done if it's explicitly marked as finished,
-    // or if there's no more content and no scheduled next event.
+    // or if there's no ad playing and no scheduled next event.
     if s.Finished {
         return true
     }
-    if s.CurrentContent == nil && s.CurrentAd == nil && time.Now().After(s.NextEventTime) {
+    if s.CurrentAd == nil && time.Now().After(s.NextEventTime) {
         return true
     }
     return false
@@ -402,64 +575,9 @@ func (s *Session) MarkAsFinished() {
     s.Finished = true
 }
 
-// StartVideo initiates the playback of a video within the session.
-func (s *Session) StartVideo(video *config.Video) {
-    s.CurrentVideo = video
-    // Calculate the video end time based on the runtime minutes of the video
-    s.VideoEndTime = time.Now().Add(video.RuntimeMinutes)
-
-    // Logging video start for monitoring or debugging
-    log.Printf("Video %s started in session %s, ends at %s", video.PrimaryTitle, s.ID, s.VideoEndTime.Format(time.RFC3339))
-}
-
-// CheckVideoProgress checks if the current video has finished playing.
-func (s *Session) CheckVideoProgress() {
-    // Check if there's a current video and the current time is past the video end time
-    if s.CurrentVideo != nil && time.Now().After(s.VideoEndTime) {
-        log.Printf("Video %s ended in session %s", s.CurrentVideo.PrimaryTitle, s.ID)
-
-        // Video has ended, clear the current video
-        s.CurrentVideo = nil
-
-
-    }
-}
-
-
-
-func (s *Session) ShouldContinueSession() bool {
-	// Check if the session is already marked as finished.
-	if s.Finished {
-		return false
-	}
-
-	// Check if there is a current video and if it has finished playing.
-	if s.CurrentVideo != nil && !time.Now().After(s.VideoEndTime) {
-		return true // Continue if the video is still playing.
-	}
-
-	// Example of engagement-based logic: Continue if engagement is above a threshold.
-	// This could be expanded based on complex user engagement models.
-	if s.EngagementLevel > 50 {
-		return true
-	}
-
-	// Check if there's a time limit on the session duration.
-	maxSessionDuration := 2 * time.Hour // Example: 2 hours max duration
-	return time.Since(s.StartTime) < maxSessionDuration 
-
-	// Add more conditions as needed, for example:
-	// - Check user's activity patterns.
-	// - Check if there are still videos in the queue to be watched.
-	// - External interruptions or conditions to end the session.
-
-	//return false // Default to ending the session if none of the conditions match.
-}
-
-
 // EndSession handles the session closure.
 func (s *Session) EndSession() {
-    log.Printf("Session %s ended", s.ID)
+    log.Printf("Session %d ended", s.ID)
     // Clean up session resources or log session completion
 }
 
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func TestCheckRemovalReportsPulledTitles(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 20, 0, 0, 0, time.UTC)
+	pulled := start.Add(30 * time.Minute)
+	tests := []struct {
+		name    string
+		windows []catalog.Window
+		status  int
+	}{
+		{"licence ends everywhere", []catalog.Window{{Until: pulled}}, 404},
+		{"licence ends in the region", []catalog.Window{{Regions: []string{"GB"}, Until: pulled}, {Regions: []string{"US"}}}, 451},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie := &catalog.Item{ID: "m", Runtime: 2 * time.Hour, Licenses: tt.windows}
+			session := &Session{Region: "GB", CurrentMovie: movie, CurrentMovieEnd: start.Add(movie.Runtime), NextEventTime: start.Add(10 * time.Minute)}
+
+			if session.checkRemoval(session.NextEventTime) {
+				t.Fatal("pulled the title before its licence ended")
+			}
+			if !session.checkRemoval(session.CurrentMovieEnd) {
+				t.Fatal("title playing past the end of its licence was not pulled")
+			}
+			removals := session.TakeRemovals()
+			if len(removals) != 1 || removals[0].Status != tt.status || !removals[0].Time.Equal(pulled) {
+				t.Fatalf("removals = %+v, want one with status %d at %v", removals, tt.status, pulled)
+			}
+			if session.CurrentMovie != nil || !session.NextEventTime.Equal(pulled) {
+				t.Errorf("playback should stop at %v, session has %v playing at %v", pulled, session.CurrentMovie, session.NextEventTime)
+			}
+		})
+	}
+}
+
+func TestFollowAuthLevelTakesUpgrades(t *testing.T) {
+	upgrade := NewState("Submit Upgrade", 307, "PUT", "free", "Logged In", time.Time{})
+	paidHome := NewState("Home", 200, "GET", "paid", "Logged In", time.Time{})
+	logout := NewState("Logout", 307, "PUT", "paid", "Logged In", time.Time{})
+	loggedOut := NewState("Home", 200, "GET", "paid", "Logged Out", time.Time{})
+	upgrade.AddUpgradeTransition(paidHome, 1)
+	paidHome.AddLateralTransition(logout, 0.1)
+	logout.AddDowngradeTransition(loggedOut, 1)
+
+	session := &Session{Auth: "Logged In", Level: "free", CurrentState: paidHome}
+	session.followAuthLevel(upgrade)
+	session.CurrentState = logout
+	session.followAuthLevel(paidHome)
+	session.CurrentState = loggedOut
+	session.followAuthLevel(logout)
+
+	if session.Auth != "Logged Out" || session.Level != "paid" {
+		t.Errorf("session is %s %s, want Logged Out paid", session.Auth, session.Level)
+	}
+	changes := session.TakeAuthLevelChanges()
+	if len(changes) != 2 || changes[0].Type != "upgrade" || changes[0].NewLevel != "paid" || changes[1].Type != "downgrade" || changes[1].OldAuth != "Logged In" {
+		t.Errorf("changes = %+v, want the upgrade to paid and the logout", changes)
+	}
+}
+
+func TestSongsPlayOutWhicheverPageComesNext(t *testing.T) {
+	start := time.Date(2024, time.April, 18, 20, 0, 0, 0, time.UTC)
+	song := NewState("NextSong", 200, "PUT", "paid", "Logged In", time.Time{})
+	home := NewState("Home", 200, "GET", "paid", "Logged In", time.Time{})
+	song.AddLateralTransition(home, 1)
+
+	session := &Session{
+		Rng:            rand.New(rand.NewSource(1)),
+		Config:         &config.Config{},
+		Auth:           "Logged In",
+		Level:          "paid",
+		CurrentState:   song,
+		CurrentSong:    &config.Song{SongID: "s", Duration: 3 * time.Minute},
+		CurrentSongEnd: start.Add(2 * time.Minute), // skipped after two minutes
+		NextEventTime:  start,
+	}
+	session.IncrementEvent()
+	if session.CurrentState != home || !session.NextEventTime.Equal(session.CurrentSongEnd) {
+		t.Errorf("moved to %s at %v, want Home when the song was skipped at %v", session.CurrentState.Page, session.NextEventTime, session.CurrentSongEnd)
+	}
+}
@@ -2,8 +2,9 @@ package models
 
 import (
 	"fmt"
-	"log"
 	"math/rand"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/chrisdamba/simstreamdata/pkg/config"
@@ -18,9 +19,60 @@ type State struct {
 	Laterals      map[*State]float64
 	Upgrades      map[*State]float64
 	Downgrades    map[*State]float64
+	Overrides     map[*State][]config.TransitionOverride // context-dependent probabilities of transitions
+	Histories     []History // transitions taken instead of these after particular pages, the longest history first
 	EventTime 	  time.Time
 }
 
+// History holds the transitions a state follows when the pages viewed before it match,
+// which makes navigation depend on more than the current page.
+type History struct {
+	Pages []string // pages viewed before the state, the most recent last
+	State *State   // holds the transitions taken after those pages
+}
+
+// TransitionContext is what a session is doing when it moves on from a page, which
+// transition overrides are matched against.
+type TransitionContext struct {
+	Time          time.Time // when the session moves on
+	Device        string
+	Tier          string
+	ItemInSession int
+}
+
+// Matches reports whether every condition that is set holds in the context.
+func (c TransitionContext) Matches(when config.TransitionCondition) bool {
+	if len(when.Hours) > 0 {
+		found := false
+		for _, hour := range when.Hours {
+			found = found || hour == c.Time.UTC().Hour()
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(when.Weekdays) > 0 {
+		found := false
+		for _, name := range when.Weekdays {
+			day, ok := config.ParseWeekday(name)
+			found = found || (ok && day == c.Time.UTC().Weekday())
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(when.Devices) > 0 && !containsFold(when.Devices, c.Device) {
+		return false
+	}
+	if len(when.Tiers) > 0 && !containsFold(when.Tiers, c.Tier) {
+		return false
+	}
+	if c.ItemInSession < when.MinItem || (when.MaxItem > 0 && c.ItemInSession > when.MaxItem) {
+		return false
+	}
+	return true
+}
+
 type Transition struct {
 	State       *State
 	Probability float64
@@ -32,8 +84,12 @@ type StateMachine struct {
 	StateGenerator 	*WeightedRandomThingGenerator[*State]
 }
 
+// AuthLevelStateMap holds every state of the session state machine and, for each auth and
+// level, the states a new session can open on.
 type AuthLevelStateMap struct {
-	Generators map[string]*WeightedRandomThingGenerator[*State]
+	Generators    map[string]*WeightedRandomThingGenerator[*State]
+	States        []*State // every state, in the order the configuration declares them
+	HistoryLength int      // pages sessions remember for history transitions, the longest history configured
 }
 
 func NewState(page string, statusCode int, method string, userLevel string, authStatus string, eventTime time.Time) *State {
@@ -47,6 +103,7 @@ func NewState(page string, statusCode int, method string, userLevel string, auth
 		Laterals:   make(map[*State]float64),
 		Upgrades:   make(map[*State]float64),
 		Downgrades: make(map[*State]float64),
+		Overrides:  make(map[*State][]config.TransitionOverride),
 	}
 }
 
@@ -85,8 +142,10 @@ func (sm *StateMachine) UpdateState(rng *rand.Rand) {
 
 func (s *State) addTransition(target *State, probability float64, transitionMap map[*State]float64) error {
 	totalProbability := 0.0
-	for _, prob := range transitionMap {
-		totalProbability += prob
+	for _, transitions := range []map[*State]float64{s.Laterals, s.Upgrades, s.Downgrades} {
+		for _, prob := range transitions {
+			totalProbability += prob
+		}
 	}
 	if totalProbability+probability > 1.0 {
 		return fmt.Errorf("total transition probability would exceed 100%%")
@@ -107,16 +166,161 @@ func (s *State) AddDowngradeTransition(target *State, probability float64) error
 	return s.addTransition(target, probability, s.Downgrades)
 }
 
+// addConfiguredTransition adds a transition of the configured type, with its overrides.
+func (s *State) addConfiguredTransition(target *State, trans config.Transition) error {
+	var err error
+	switch trans.Type {
+	case "", "lateral":
+		err = s.AddLateralTransition(target, trans.P)
+	case "upgrade":
+		err = s.AddUpgradeTransition(target, trans.P)
+	case "downgrade":
+		err = s.AddDowngradeTransition(target, trans.P)
+	default:
+		err = fmt.Errorf("unknown transition type %q", trans.Type)
+	}
+	if err == nil && len(trans.Overrides) > 0 {
+		s.Overrides[target] = trans.Overrides
+	}
+	return err
+}
+
+// TransitionType returns whether moving to target is an upgrade, a downgrade or, for
+// lateral transitions and states target is not a transition of, lateral. Transitions
+// taken after a history count too.
+func (s *State) TransitionType(target *State) string {
+	if _, ok := s.Upgrades[target]; ok {
+		return "upgrade"
+	}
+	if _, ok := s.Downgrades[target]; ok {
+		return "downgrade"
+	}
+	for _, history := range s.Histories {
+		if kind := history.State.TransitionType(target); kind != "lateral" {
+			return kind
+		}
+	}
+	return "lateral"
+}
+
+// changesLevel reports whether the state, or a history of it, has an upgrade or downgrade
+// transition, as kind says, to another level.
+func (s *State) changesLevel(kind string) bool {
+	transitions := s.Upgrades
+	if kind == "downgrade" {
+		transitions = s.Downgrades
+	}
+	for target := range transitions {
+		if target.UserLevel != "" && target.UserLevel != s.UserLevel {
+			return true
+		}
+	}
+	for _, history := range s.Histories {
+		if history.State.changesLevel(kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// history returns the state holding the transitions taken after the pages, adding it if
+// the state has none yet.
+func (s *State) history(pages []string) *State {
+	for _, history := range s.Histories {
+		if equalPages(history.Pages, pages) {
+			return history.State
+		}
+	}
+	state := NewState(s.Page, s.StatusCode, s.Method, s.UserLevel, s.AuthStatus, s.EventTime)
+	s.Histories = append(s.Histories, History{Pages: pages, State: state})
+	sort.SliceStable(s.Histories, func(i, j int) bool { return len(s.Histories[i].Pages) > len(s.Histories[j].Pages) })
+	return state
+}
+
+// After returns the state whose transitions to follow when the pages were viewed before
+// this one, the most recent last: the longest history that the pages end with, or the
+// state itself when none does.
+func (s *State) After(pages []string) *State {
+	for _, history := range s.Histories {
+		if n := len(history.Pages); n <= len(pages) && equalPages(history.Pages, pages[len(pages)-n:]) {
+			return history.State
+		}
+	}
+	return s
+}
+
+func equalPages(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *State) GetNextState(rng *rand.Rand) *State {
-	combinedTransitions := make(map[*State]float64)
-	for state, prob := range s.Laterals {
-		combinedTransitions[state] += prob
+	return s.GetNextStateExcluding(rng, nil)
+}
+
+// GetNextStateExcluding picks the next state like GetNextState but never moves to a page
+// in blocked. The probability of the blocked transitions is spread proportionally over the
+// remaining ones, so the chance of ending the session stays the same.
+func (s *State) GetNextStateExcluding(rng *rand.Rand, blocked map[string]bool) *State {
+	return s.GetNextStateInContext(rng, nil, blocked)
+}
+
+// transitionsIn returns the probability of moving to each state in the context: the first
+// override of a transition that matches replaces its probability. Overrides that push the
+// total above 1 are scaled down with the rest, leaving no chance of ending the session. A
+// nil context uses the configured probabilities.
+func (s *State) transitionsIn(ctx *TransitionContext) map[*State]float64 {
+	combined := s.transitions()
+	if ctx == nil || len(s.Overrides) == 0 {
+		return combined
 	}
-	for state, prob := range s.Upgrades {
-		combinedTransitions[state] += prob
+	for state, overrides := range s.Overrides {
+		for _, override := range overrides {
+			if ctx.Matches(override.When) {
+				combined[state] = override.P
+				break
+			}
+		}
+	}
+	total := 0.0
+	for _, prob := range combined {
+		total += prob
 	}
-	for state, prob := range s.Downgrades {
-		combinedTransitions[state] += prob
+	if total > 1 {
+		for state := range combined {
+			combined[state] /= total
+		}
+	}
+	return combined
+}
+
+// GetNextStateInContext picks the next state like GetNextStateExcluding, using the
+// probabilities the transition overrides give in the session's context.
+func (s *State) GetNextStateInContext(rng *rand.Rand, ctx *TransitionContext, blocked map[string]bool) *State {
+	combinedTransitions := s.transitionsIn(ctx)
+	if len(blocked) > 0 {
+		total, allowed := 0.0, 0.0
+		for state, prob := range combinedTransitions {
+			total += prob
+			if blocked[state.Page] {
+				delete(combinedTransitions, state)
+			} else {
+				allowed += prob
+			}
+		}
+		if allowed == 0 {
+			return nil
+		}
+		for state := range combinedTransitions {
+			combinedTransitions[state] *= total / allowed
+		}
 	}
 	p := rng.Float64()
 	total := 0.0
@@ -151,33 +355,72 @@ func (alm *AuthLevelStateMap) GetRandomState(auth, level string, rng *rand.Rand)
 	return nil // or default state if required
 }
 
-func InitializeStatesWithAuthLevel(cfg *config.Config, rng *rand.Rand) *AuthLevelStateMap {
+// CanStart reports whether sessions can open with the given auth and level.
+func (alm *AuthLevelStateMap) CanStart(auth, level string) bool {
+	_, exists := alm.Generators[auth+"|"+level]
+	return exists
+}
+
+// InitializeStatesWithAuthLevel builds the session state machine from the configuration.
+// States are the new-session pages and the destinations of transitions; a transition whose
+// source is neither can never be taken and is reported as an error, as are transitions of
+// an unknown type and a state whose transitions add up to more than 100%. Transitions with
+// a history are kept apart from the source's other transitions, see State.After.
+func InitializeStatesWithAuthLevel(cfg *config.Config) (*AuthLevelStateMap, error) {
 	stateMap := NewAuthLevelStateMap()
-	tempStateMap := make(map[string]*State) 
-	sm := NewStateMachine(rng)
+	states := make(map[config.StateConfig]*State) // keyed by the full (page, method, status, auth, level) tuple
+	state := func(key config.StateConfig) *State {
+		if s, ok := states[key]; ok {
+			return s
+		}
+		s := NewState(key.Page, key.Status, key.Method, key.Level, key.Auth, time.Now())
+		states[key] = s
+		stateMap.States = append(stateMap.States, s)
+		return s
+	}
 	for _, page := range cfg.NewSessionPages {
-		state := NewState(
-			page.Page,
-			page.Status,
-			page.Method,
-			page.Level,
-			page.Auth,
-			time.Now(),
-		)
-		sm.AddState(state, page.Weight)
-		stateMap.Add(page.Auth, page.Level, state, page.Weight)
-		tempStateMap[page.Page] = state
+		key := config.StateConfig{Page: page.Page, Method: page.Method, Status: page.Status, Auth: page.Auth, Level: page.Level}
+		stateMap.Add(page.Auth, page.Level, state(key), page.Weight)
 	}
-
 	for _, trans := range cfg.Transitions {
-		sourceState := tempStateMap[trans.Source.Page]
-		destState := tempStateMap[trans.Dest.Page]
-		if sourceState != nil && destState != nil {
-			if err := sourceState.AddLateralTransition(destState, trans.P); err != nil {
-				log.Printf("Error adding transition: %v", err)
-			}			
+		state(trans.Dest)
+	}
+
+	for i, trans := range cfg.Transitions {
+		sourceState, ok := states[trans.Source]
+		if !ok {
+			return nil, fmt.Errorf("transition %d: source %s is neither a new-session page nor the destination of a transition", i, trans.Source)
+		}
+		if len(trans.History) > 0 {
+			sourceState = sourceState.history(trans.History)
+			if len(trans.History) > stateMap.HistoryLength {
+				stateMap.HistoryLength = len(trans.History)
+			}
+		}
+		if err := sourceState.addConfiguredTransition(states[trans.Dest], trans); err != nil {
+			return nil, fmt.Errorf("transition %d from %s: %w", i, trans.Source, err)
 		}
 	}
 
-	return stateMap
+	return stateMap, nil
+}
+
+// HistoryTransitions describes the transitions that depend on the pages viewed before a
+// state, one line per state and history, e.g. "GET Home 200 (Logged In, free) after Help,
+// About: 2 transitions". The chain analysis and the graph follow first-order transitions
+// only, so they leave these out.
+func (alm *AuthLevelStateMap) HistoryTransitions() []string {
+	var lines []string
+	for _, state := range alm.States {
+		for _, history := range state.Histories {
+			n, noun := len(history.State.transitions()), "transitions"
+			if n == 1 {
+				noun = "transition"
+			}
+			lines = append(lines, fmt.Sprintf("%s %s %d (%s, %s) after %s: %d %s",
+				state.Method, state.Page, state.StatusCode, state.AuthStatus, state.UserLevel,
+				strings.Join(history.Pages, ", "), n, noun))
+		}
+	}
+	return lines
 }
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+func TestInitializeStatesKeysByFullTuple(t *testing.T) {
+	cfg, err := config.LoadConfig("../../configs/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateMap, err := InitializeStatesWithAuthLevel(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transitions := 0
+	for _, state := range stateMap.States {
+		transitions += len(state.Laterals) + len(state.Upgrades) + len(state.Downgrades)
+		for _, history := range state.Histories {
+			transitions += len(history.State.Laterals) + len(history.State.Upgrades) + len(history.State.Downgrades)
+		}
+	}
+	if transitions != len(cfg.Transitions) {
+		t.Errorf("built %d transitions, want all %d from the configuration", transitions, len(cfg.Transitions))
+	}
+
+	home := map[string]bool{}
+	for _, state := range stateMap.States {
+		if state.Page == "Home" {
+			home[state.AuthStatus+"|"+state.UserLevel] = true
+		}
+	}
+	if len(home) < 2 {
+		t.Errorf("Home states for %v, want one per auth and level", home)
+	}
+}
+
+func TestInitializeStatesRejectsDanglingSources(t *testing.T) {
+	home := config.StateConfig{Page: "Home", Method: "GET", Status: 200, Auth: "Logged In", Level: "free"}
+	about := config.StateConfig{Page: "About", Method: "GET", Status: 200, Auth: "Logged In", Level: "free"}
+	paidAbout := about
+	paidAbout.Level = "paid"
+	cfg := &config.Config{
+		NewSessionPages: []config.SessionPage{{Page: "Home", Method: "GET", Status: 200, Auth: "Logged In", Level: "free", Weight: 1}},
+		Transitions: []config.Transition{
+			{Source: home, Dest: about, P: 0.5},
+			{Source: paidAbout, Dest: home, P: 0.5},
+		},
+	}
+
+	_, err := InitializeStatesWithAuthLevel(cfg)
+	if err == nil || !strings.Contains(err.Error(), "transition 1") {
+		t.Fatalf("err = %v, want the transition from the unreachable paid About page reported", err)
+	}
+
+	cfg.Transitions[1].Source = about
+	stateMap, err := InitializeStatesWithAuthLevel(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stateMap.States) != 2 {
+		t.Errorf("got %d states, want Home and About", len(stateMap.States))
+	}
+}
+
+func TestInitializeStatesSortsTransitionsByType(t *testing.T) {
+	login := config.StateConfig{Page: "Login", Method: "PUT", Status: 307, Auth: "Logged Out", Level: "free"}
+	home := config.StateConfig{Page: "Home", Method: "GET", Status: 200, Auth: "Logged In", Level: "free"}
+	cfg := &config.Config{
+		NewSessionPages: []config.SessionPage{{Page: "Login", Method: "PUT", Status: 307, Auth: "Logged Out", Level: "free", Weight: 1}},
+		Transitions:     []config.Transition{{Source: login, Dest: home, P: 0.9, Type: "upgrade"}},
+	}
+	stateMap, err := InitializeStatesWithAuthLevel(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to := stateMap.States[0], stateMap.States[1]
+	if len(from.Laterals) != 0 || from.Upgrades[to] != 0.9 || from.TransitionType(to) != "upgrade" {
+		t.Errorf("laterals %v, upgrades %v, want the login as an upgrade", from.Laterals, from.Upgrades)
+	}
+
+	cfg.Transitions[0].Type = "sideways"
+	if _, err := InitializeStatesWithAuthLevel(cfg); err == nil {
+		t.Error("accepted a transition of an unknown type")
+	}
+}
+
+func TestTransitionOverridesFollowTheContext(t *testing.T) {
+	home := config.StateConfig{Page: "Home", Method: "GET", Status: 200, Auth: "Logged In", Level: "paid"}
+	logout := config.StateConfig{Page: "Logout", Method: "PUT", Status: 307, Auth: "Logged In", Level: "paid"}
+	video := config.StateConfig{Page: "NextVideo", Method: "PUT", Status: 200, Auth: "Logged In", Level: "paid"}
+	cfg := &config.Config{
+		NewSessionPages: []config.SessionPage{{Page: "Home", Method: "GET", Status: 200, Auth: "Logged In", Level: "paid", Weight: 1}},
+		Transitions: []config.Transition{
+			{Source: home, Dest: logout, P: 0.1, Overrides: []config.TransitionOverride{
+				{When: config.TransitionCondition{Devices: []string{"smartphone"}, Hours: []int{23, 0}}, P: 0.6},
+				{When: config.TransitionCondition{Weekdays: []string{"Sat"}, MinItem: 5}, P: 0},
+			}},
+			{Source: home, Dest: video, P: 0.8},
+		},
+	}
+	stateMap, err := InitializeStatesWithAuthLevel(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var source, logoutState *State
+	for _, state := range stateMap.States {
+		switch state.Page {
+		case "Home":
+			source = state
+		case "Logout":
+			logoutState = state
+		}
+	}
+
+	thursdayNight := time.Date(2024, time.April, 18, 23, 30, 0, 0, time.UTC)
+	saturdayNoon := time.Date(2024, time.April, 20, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		ctx  *TransitionContext
+		want float64
+	}{
+		{"no context", nil, 0.1},
+		{"mobile at night", &TransitionContext{Time: thursdayNight, Device: "smartphone"}, 0.6 / 1.4},
+		{"desktop at night", &TransitionContext{Time: thursdayNight, Device: "desktop"}, 0.1},
+		{"weekend, late in the session", &TransitionContext{Time: saturdayNoon, ItemInSession: 7}, 0},
+		{"weekend, early in the session", &TransitionContext{Time: saturdayNoon, ItemInSession: 2}, 0.1},
+	}
+	for _, tt := range tests {
+		if got := source.transitionsIn(tt.ctx)[logoutState]; math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: p(Logout) = %g, want %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryTransitionsFollowThePagesBefore(t *testing.T) {
+	page := func(name string) config.StateConfig {
+		return config.StateConfig{Page: name, Method: "GET", Status: 200, Auth: "Guest", Level: "free"}
+	}
+	cfg := &config.Config{
+		Alpha:           30,
+		NewSessionPages: []config.SessionPage{{Page: "Home", Method: "GET", Status: 200, Auth: "Guest", Level: "free", Weight: 1}},
+		Transitions: []config.Transition{
+			{Source: page("Home"), Dest: page("Help"), P: 0.5},
+			{Source: page("Home"), Dest: page("About"), P: 0.5},
+			{Source: page("Help"), Dest: page("Home"), P: 1},
+			{Source: page("About"), Dest: page("Home"), P: 1},
+			{Source: page("Home"), Dest: page("Help"), History: []string{"Help"}, P: 1},
+			{Source: page("Home"), Dest: page("About"), History: []string{"About", "Help"}, P: 1},
+		},
+	}
+	stateMap, err := InitializeStatesWithAuthLevel(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stateMap.HistoryLength != 2 {
+		t.Errorf("history length = %d, want the longest configured history", stateMap.HistoryLength)
+	}
+	want := []string{"GET Home 200 (Guest, free) after About, Help: 1 transition", "GET Home 200 (Guest, free) after Help: 1 transition"}
+	if got := stateMap.HistoryTransitions(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("history transitions = %q, want %q", got, want)
+	}
+	home := stateMap.GetRandomState("Guest", "free", rand.New(rand.NewSource(1)))
+	if got := home.After([]string{"About", "Help"}); got == home || got.Histories != nil || len(got.Laterals) != 1 {
+		t.Errorf("after About, Help: %+v, want the transitions of the history that matches", got)
+	}
+	if got := home.After([]string{"Help", "About"}); got != home {
+		t.Error("after Help, About: want the first-order transitions, as no history ends with About")
+	}
+
+	session := &Session{Rng: rand.New(rand.NewSource(1)), Config: cfg, StateMap: stateMap, CurrentState: home, Auth: "Guest", Level: "free", NextEventTime: time.Unix(0, 0)}
+	var pages []string
+	for i := 0; i < 12 && !session.Finished; i++ {
+		session.IncrementEvent()
+		pages = append(pages, session.CurrentState.Page)
+	}
+	for i := 2; i < len(pages); i++ {
+		if pages[i] == "Home" && pages[i-1] == "Help" && i+1 < len(pages) && pages[i+1] != "Help" {
+			t.Fatalf("left Home for %s after Help: %v", pages[i+1], pages)
+		}
+	}
+	if session.PreviousState == nil || session.PreviousState.Page != pages[len(pages)-2] {
+		t.Errorf("previous state = %v, want %s", session.PreviousState, pages[len(pages)-2])
+	}
+}
+
+func TestGetNextStateExcludingSkipsBlockedPages(t *testing.T) {
+	page := func(name string) config.StateConfig {
+		return config.StateConfig{Page: name, Method: "GET", Status: 200, Auth: "Logged In", Level: "free"}
+	}
+	cfg := &config.Config{
+		NewSessionPages: []config.SessionPage{{Page: "Home", Method: "GET", Status: 200, Auth: "Logged In", Level: "free", Weight: 1}},
+		Transitions: []config.Transition{
+			{Source: page("Home"), Dest: page("Upgrade"), P: 0.2},
+			{Source: page("Home"), Dest: page("NextVideo"), P: 0.5},
+			{Source: page("Home"), Dest: page("Help"), P: 0.1},
+		},
+	}
+	stateMap, err := InitializeStatesWithAuthLevel(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := stateMap.GetRandomState("Logged In", "free", rand.New(rand.NewSource(1)))
+
+	tests := []struct {
+		name    string
+		blocked map[string]bool
+		want    map[string]float64 // share of draws per page, "" for the end of the session
+	}{
+		{"nothing blocked", nil, map[string]float64{"Upgrade": 0.2, "NextVideo": 0.5, "Help": 0.1, "": 0.2}},
+		{"upgrade blocked", map[string]bool{"Upgrade": true}, map[string]float64{"NextVideo": 0.5 * 0.8 / 0.6, "Help": 0.1 * 0.8 / 0.6, "": 0.2}},
+		{"other pages blocked", map[string]bool{"Upgrade": true, "Help": true}, map[string]float64{"NextVideo": 0.8, "": 0.2}},
+		{"every page blocked", map[string]bool{"Upgrade": true, "NextVideo": true, "Help": true}, map[string]float64{"": 1}},
+	}
+	const draws = 20000
+	for _, tt := range tests {
+		rng := rand.New(rand.NewSource(1))
+		counts := map[string]int{}
+		for i := 0; i < draws; i++ {
+			page := ""
+			if next := home.GetNextStateExcluding(rng, tt.blocked); next != nil {
+				page = next.Page
+			}
+			counts[page]++
+		}
+		for page := range counts {
+			if _, ok := tt.want[page]; !ok {
+				t.Errorf("%s: moved to %q", tt.name, page)
+			}
+		}
+		for page, share := range tt.want {
+			if got := float64(counts[page]) / draws; math.Abs(got-share) > 0.015 {
+				t.Errorf("%s: share of %q = %.3f, want %.3f", tt.name, page, got, share)
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+// Subscription tracks where a user is in the subscription lifecycle beyond the current tier.
+type Subscription struct {
+	Trialled  bool             // the user has already used their free trial
+	TrialEnds time.Time        // end of the running trial, zero when not on trial
+	TrialFrom SubscriptionType // tier to return to if the trial does not convert
+	CancelAt  time.Time        // end of the grace period of a cancelled subscription, zero when not cancelled
+}
+
+// StatusChange records a change of a user's subscription.
+type StatusChange struct {
+	Time   time.Time
+	Old    SubscriptionType
+	New    SubscriptionType
+	Reason string
+}
+
+// tierLadder lists the subscription tiers from the cheapest to the most expensive.
+func tierLadder(cfg *config.Config) []SubscriptionType {
+	if len(cfg.SubscriptionTiers) == 0 {
+		return []SubscriptionType{Free, Basic, Premium}
+	}
+	ladder := make([]SubscriptionType, len(cfg.SubscriptionTiers))
+	for i, tier := range cfg.SubscriptionTiers {
+		ladder[i] = SubscriptionType(strings.ToLower(tier.Name))
+	}
+	return ladder
+}
+
+// tierForLevel returns the nearest tier up (or down, when step is negative) the ladder that
+// maps to the session level, or the tier one step that way when none does or level is empty.
+func tierForLevel(cfg *config.Config, tier SubscriptionType, level string, step int) SubscriptionType {
+	if level == "" {
+		return stepTier(cfg, tier, step)
+	}
+	ladder := tierLadder(cfg)
+	position := 0
+	for i, t := range ladder {
+		if t == tier {
+			position = i
+		}
+	}
+	for i := position + step; i >= 0 && i < len(ladder); i += step {
+		if levelForTier(cfg, ladder[i]) == level {
+			return ladder[i]
+		}
+	}
+	return stepTier(cfg, tier, step)
+}
+
+// stepTier returns the tier the given number of steps up (or down, when negative) the ladder.
+func stepTier(cfg *config.Config, tier SubscriptionType, steps int) SubscriptionType {
+	ladder := tierLadder(cfg)
+	position := 0
+	for i, t := range ladder {
+		if t == tier {
+			position = i
+		}
+	}
+	position += steps
+	if position < 0 {
+		position = 0
+	}
+	if position >= len(ladder) {
+		position = len(ladder) - 1
+	}
+	return ladder[position]
+}
+
+// levelForTier returns the session level the tier maps to.
+func levelForTier(cfg *config.Config, tier SubscriptionType) string {
+	if t, ok := cfg.Tier(string(tier)); ok && t.Level != "" {
+		return t.Level
+	}
+	if tier == Free || tier == "" {
+		return "free"
+	}
+	return "paid"
+}
+
+// advanceSubscription runs the subscription lifecycle at the user's current simulated time:
+// trials and grace periods that have run out take effect first, then the change requested
+// by the page the session just entered, if any. Upgrade and downgrade pages that leave by
+// an upgrade or downgrade transition to another level change the tier when the session
+// takes that transition instead, see queueAuthLevelChanges.
+func (u *User) advanceSubscription(enteredPage string) {
+	now := u.CurrentSession.NextEventTime
+	sub := &u.Subscription
+	lifecycle := u.Config.SubscriptionLifecycle
+
+	if !sub.TrialEnds.IsZero() && !now.Before(sub.TrialEnds) {
+		sub.TrialEnds = time.Time{}
+		if u.Rng.Float64() < lifecycle.TrialConversion {
+			u.queueStatusChange(u.changeTier(u.SubscriptionType, "trial-converted", now))
+		} else {
+			u.queueStatusChange(u.changeTier(sub.TrialFrom, "trial-expired", now))
+		}
+	}
+	if !sub.CancelAt.IsZero() && !now.Before(sub.CancelAt) {
+		u.clearCancellation()
+		u.queueStatusChange(u.changeTier(tierLadder(u.Config)[0], "grace-expired", now))
+	}
+
+	entered := u.CurrentSession.CurrentState
+	switch enteredPage {
+	case "Submit Upgrade":
+		if !entered.changesLevel("upgrade") {
+			u.lastStatusChange = u.upgrade("", now)
+		}
+	case "Submit Downgrade":
+		if !entered.changesLevel("downgrade") {
+			u.lastStatusChange = u.downgrade("", now)
+		}
+	case "Cancellation Confirmation":
+		u.lastStatusChange = u.cancel(now)
+	}
+}
+
+// upgrade starts the user's free trial the first time a free user upgrades, if configured,
+// and otherwise moves the user one tier up, or up to the nearest tier of the session level
+// when one is given. Upgrading also withdraws a pending cancellation. It returns nil when
+// the user is already on the top tier.
+func (u *User) upgrade(level string, now time.Time) *StatusChange {
+	sub := &u.Subscription
+	lifecycle := u.Config.SubscriptionLifecycle
+	lowest := tierLadder(u.Config)[0]
+
+	if !sub.TrialEnds.IsZero() {
+		sub.TrialEnds = time.Time{}
+		return u.changeTier(u.SubscriptionType, "trial-converted", now)
+	}
+	u.clearCancellation()
+	if lifecycle.TrialDays > 0 && !sub.Trialled && u.SubscriptionType == lowest && u.Rng.Float64() < lifecycle.TrialChance {
+		trialTier := stepTier(u.Config, u.SubscriptionType, 1)
+		if lifecycle.TrialTier != "" {
+			trialTier = SubscriptionType(strings.ToLower(lifecycle.TrialTier))
+		}
+		sub.Trialled = true
+		sub.TrialFrom = u.SubscriptionType
+		sub.TrialEnds = now.AddDate(0, 0, lifecycle.TrialDays)
+		return u.changeTier(trialTier, "trial-started", now)
+	}
+	next := tierForLevel(u.Config, u.SubscriptionType, level, 1)
+	if next == u.SubscriptionType {
+		return nil
+	}
+	return u.changeTier(next, "upgrade", now)
+}
+
+// downgrade moves the user one tier down, or down to the nearest tier of the session level
+// when one is given, or back to their previous tier during a trial. It returns nil when the
+// user is already on the lowest tier.
+func (u *User) downgrade(level string, now time.Time) *StatusChange {
+	sub := &u.Subscription
+	if !sub.TrialEnds.IsZero() {
+		sub.TrialEnds = time.Time{}
+		return u.changeTier(sub.TrialFrom, "trial-cancelled", now)
+	}
+	next := tierForLevel(u.Config, u.SubscriptionType, level, -1)
+	if next == u.SubscriptionType {
+		return nil
+	}
+	return u.changeTier(next, "downgrade", now)
+}
+
+// cancel ends a trial straight away. A paid subscription stays active until the end of
+// the grace period and drops to the cheapest tier afterwards.
+func (u *User) cancel(now time.Time) *StatusChange {
+	sub := &u.Subscription
+	lowest := tierLadder(u.Config)[0]
+	if !sub.TrialEnds.IsZero() {
+		sub.TrialEnds = time.Time{}
+		return u.changeTier(sub.TrialFrom, "trial-cancelled", now)
+	}
+	grace := u.Config.SubscriptionLifecycle.GracePeriodDays
+	if u.SubscriptionType == lowest || grace <= 0 {
+		return u.changeTier(lowest, "cancelled", now)
+	}
+	sub.CancelAt = now.AddDate(0, 0, grace)
+	return &StatusChange{Time: now, Old: u.SubscriptionType, New: u.SubscriptionType, Reason: "cancel-scheduled"}
+}
+
+// clearCancellation drops a scheduled cancellation. Billing stopped when a renewal fell
+// into the grace period, so a priced plan is billed again from the end of the grace period.
+func (u *User) clearCancellation() {
+	sub := &u.Subscription
+	if sub.CancelAt.IsZero() {
+		return
+	}
+	if u.Billing.NextCharge.IsZero() && u.planPrice(u.SubscriptionType) > 0 {
+		u.Billing.NextCharge = sub.CancelAt
+	}
+	sub.CancelAt = time.Time{}
+}
+
+// changeTier moves the user and their current session to the tier and its level.
+func (u *User) changeTier(tier SubscriptionType, reason string, now time.Time) *StatusChange {
+	change := &StatusChange{Time: now, Old: u.SubscriptionType, New: tier, Reason: reason}
+	u.SubscriptionType = tier
+	u.CurrentSession.ChangeSubscription(tier, levelForTier(u.Config, tier))
+	u.billTierChange(change)
+	return change
+}
+
+// queueStatusChange reports a change that did not come from a page view, such as a trial
+// expiring, on the status change topic. A nil change, one that did not move the user, is
+// not reported.
+func (u *User) queueStatusChange(change *StatusChange) {
+	if change == nil {
+		return
+	}
+	baseEvent := u.pageViewEvent()
+	baseEvent.Timestamp = change.Time.Unix()
+	u.queueEvent("status_change_events", StatusChangeEvent{
+		PageViewEvent: baseEvent,
+		OldStatus:     string(change.Old),
+		NewStatus:     string(change.New),
+		Reason:        change.Reason,
+	})
+}
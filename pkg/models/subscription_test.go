@@ -0,0 +1,160 @@
+package models
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+var subscriptionTiers = []config.SubscriptionTier{
+	{Name: "free", Level: "free"},
+	{Name: "basic", Level: "paid", Price: 5},
+	{Name: "premium", Level: "paid", Price: 10},
+}
+
+// newSubscriber returns a user on the tier with a session, ready to change subscription.
+func newSubscriber(cfg *config.Config, tier SubscriptionType) *User {
+	if cfg.SubscriptionTiers == nil {
+		cfg.SubscriptionTiers = subscriptionTiers
+	}
+	level := levelForTier(cfg, tier)
+	now := time.Date(2024, time.April, 18, 12, 0, 0, 0, time.UTC)
+	return &User{
+		ID:               1,
+		SubscriptionType: tier,
+		Config:           cfg,
+		Rng:              rand.New(rand.NewSource(1)),
+		Device:           map[string]interface{}{"type": "desktop", "os": "linux"},
+		Properties:       map[string]interface{}{"firstName": "Ada", "lastName": "Lovelace", "dob": "1990-01-01"},
+		Region:           config.Region{Name: "uk", Currency: "GBP", PriceMultiplier: 1},
+		CurrentSession: &Session{
+			Auth:          "Logged In",
+			Level:         level,
+			CurrentState:  NewState("Home", 200, "GET", level, "Logged In", now),
+			StartTime:     now,
+			NextEventTime: now,
+		},
+	}
+}
+
+// queuedTopics returns the topics of the events the user queued, in order.
+func queuedTopics(t *testing.T, u *User) []string {
+	t.Helper()
+	var topics []string
+	for _, event := range u.FlushEvents() {
+		topics = append(topics, event.Topic)
+	}
+	return topics
+}
+
+func upgradeOneTier(u *User, now time.Time) *StatusChange   { return u.upgrade("", now) }
+func downgradeOneTier(u *User, now time.Time) *StatusChange { return u.downgrade("", now) }
+
+func TestSubscriptionChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		tier   SubscriptionType
+		grace  int
+		change func(u *User, now time.Time) *StatusChange
+		want   *StatusChange // nil when the user stays where they are
+		level  string
+	}{
+		{"upgrade", Free, 0, upgradeOneTier, &StatusChange{Old: Free, New: Basic, Reason: "upgrade"}, "paid"},
+		{"upgrade on the top tier", Premium, 0, upgradeOneTier, nil, "paid"},
+		{"downgrade", Basic, 0, downgradeOneTier, &StatusChange{Old: Basic, New: Free, Reason: "downgrade"}, "free"},
+		{"downgrade on the lowest tier", Free, 0, downgradeOneTier, nil, "free"},
+		{"cancel without a grace period", Premium, 0, (*User).cancel, &StatusChange{Old: Premium, New: Free, Reason: "cancelled"}, "free"},
+		{"cancel with a grace period", Premium, 7, (*User).cancel, &StatusChange{Old: Premium, New: Premium, Reason: "cancel-scheduled"}, "paid"},
+	}
+	for _, tt := range tests {
+		u := newSubscriber(&config.Config{SubscriptionLifecycle: config.SubscriptionLifecycle{GracePeriodDays: tt.grace}}, tt.tier)
+		now := u.CurrentSession.NextEventTime
+		got := tt.change(u, now)
+		switch {
+		case tt.want == nil && got != nil:
+			t.Errorf("%s: changed %s to %s, want no change", tt.name, got.Old, got.New)
+		case tt.want != nil && (got == nil || got.Old != tt.want.Old || got.New != tt.want.New || got.Reason != tt.want.Reason):
+			t.Errorf("%s: change = %+v, want %+v", tt.name, got, tt.want)
+		}
+		if u.CurrentSession.Level != tt.level {
+			t.Errorf("%s: session level = %s, want %s", tt.name, u.CurrentSession.Level, tt.level)
+		}
+		if tt.grace > 0 && !u.Subscription.CancelAt.Equal(now.AddDate(0, 0, tt.grace)) {
+			t.Errorf("%s: cancellation at %v, want the end of the grace period", tt.name, u.Subscription.CancelAt)
+		}
+	}
+}
+
+func TestNoOpSubscriptionPagesAreNotStatusChanges(t *testing.T) {
+	u := newSubscriber(&config.Config{}, Free)
+	u.CurrentSession.CurrentState = NewState("Submit Downgrade", 307, "PUT", "free", "Logged In", u.CurrentSession.NextEventTime)
+	u.advanceSubscription("Submit Downgrade")
+	if u.lastStatusChange != nil {
+		t.Fatalf("downgrade on the lowest tier recorded %+v", u.lastStatusChange)
+	}
+	message, err := u.Serialize(u.Rng, u.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal(message.Message, &event); err != nil {
+		t.Fatal(err)
+	}
+	if message.Topic != "page_views_events" || event["oldStatus"] != nil {
+		t.Errorf("reported on %s as %v, want a plain page view", message.Topic, event)
+	}
+	if topics := queuedTopics(t, u); len(topics) != 0 {
+		t.Errorf("queued %v, want nothing", topics)
+	}
+}
+
+func TestUpgradeAndDowngradePagesChangeTheTierOnce(t *testing.T) {
+	tests := []struct {
+		name  string
+		typed bool // the page leaves by a downgrade transition to the free level
+		tiers []SubscriptionType
+	}{
+		{"downgrade transition", true, []SubscriptionType{Free}},
+		{"lateral transitions only", false, []SubscriptionType{Basic}},
+	}
+	for _, tt := range tests {
+		u := newSubscriber(&config.Config{}, Premium)
+		now := u.CurrentSession.NextEventTime
+		page := NewState("Submit Downgrade", 307, "PUT", "paid", "Logged In", now)
+		if tt.typed {
+			page.AddDowngradeTransition(NewState("Home", 200, "GET", "free", "Logged In", now), 1)
+		} else {
+			page.AddLateralTransition(NewState("Home", 200, "GET", "paid", "Logged In", now), 1)
+		}
+		u.CurrentSession.CurrentState = page
+		u.advanceSubscription("Submit Downgrade")
+		if tt.typed {
+			u.CurrentSession.Level = "free"
+			u.CurrentSession.authLevelChanges = []AuthLevelChange{{Time: now, Type: "downgrade", OldAuth: "Logged In", NewAuth: "Logged In", OldLevel: "paid", NewLevel: "free"}}
+		}
+		u.queueAuthLevelChanges()
+
+		var tiers []SubscriptionType
+		if u.lastStatusChange != nil {
+			tiers = append(tiers, u.lastStatusChange.New)
+		}
+		for _, event := range u.FlushEvents() {
+			if event.Topic == "status_change_events" {
+				var change StatusChangeEvent
+				if err := json.Unmarshal(event.Message, &change); err != nil {
+					t.Fatal(err)
+				}
+				tiers = append(tiers, SubscriptionType(change.NewStatus))
+			}
+		}
+		if len(tiers) != len(tt.tiers) || tiers[0] != tt.tiers[0] {
+			t.Errorf("%s: changed to %v, want %v", tt.name, tiers, tt.tiers)
+		}
+		if u.CurrentSession.Level != levelForTier(u.Config, u.SubscriptionType) {
+			t.Errorf("%s: session level %s on tier %s", tt.name, u.CurrentSession.Level, u.SubscriptionType)
+		}
+	}
+}
@@ -3,9 +3,13 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"math/rand"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
 	"github.com/chrisdamba/simstreamdata/pkg/config"
 	"github.com/bxcodec/faker/v3"
 )
@@ -23,12 +27,21 @@ type User struct {
 	Device           map[string]interface{}
 	PreferredGenres  []string
 	FavoriteShows    []string
-	GenrePreferences map[string]int // weight for each genre
+	GenrePreferences map[string]float64 // weight for each genre
+	SeriesProgress   SeriesProgress     // next episode of every series the user is watching
+	LiveDecisions    map[string]bool    // live events the user has decided whether to watch
 	ViewingHours     int
 	SubscriptionType SubscriptionType
+	Subscription     Subscription
+	Billing          Billing
+	Region           config.Region
+	AdHistory        *AdHistory
 	CurrentSession   *Session
 	Rng             *rand.Rand
 	Config          *config.Config
+	Platform        *Platform
+	pendingEvents   []EventMessage // events produced alongside page views, e.g. ad requests
+	lastStatusChange *StatusChange // subscription change made by the page the session is on
 }
 
 // Queue interface defines the queue operations.
@@ -93,6 +106,7 @@ type PageViewEvent struct {
 	SessionDuration float64 `json:"sessionDuration"`
 	Page           string `json:"page"`
 	Auth           string `json:"auth"`
+	Level          string `json:"level,omitempty"`
 	Method         string `json:"method"`
 	Status         int    `json:"status"`
 	UserID         int64 `json:"userId"`
@@ -104,11 +118,13 @@ type PageViewEvent struct {
 	LastName 					string `json:"lastName"`
 	Gender 						string `json:"gender"`
 	DateOfBirth				string `json:"dob"`
+	Region          string `json:"region,omitempty"`
 }
 
 type AuthEvent struct {
 	PageViewEvent
 	Success    bool `json:"success"`
+	PreviousAuth string `json:"previousAuth,omitempty"` // set when the event reports a change of auth
 }
 
 type ListenEvent struct {
@@ -116,6 +132,8 @@ type ListenEvent struct {
 	SongID     	string `json:"songId"`
 	AudioTitle  string `json:"audioTitle"`
 	ArtistName	string `json:"artistName"`
+	AlbumTitle  string `json:"albumTitle,omitempty"`
+	Genre       string `json:"genre,omitempty"`
 	Duration    int 	 `json:"duration"` // in seconds
 }
 
@@ -125,19 +143,66 @@ type WatchEvent struct {
 	VideoTitle  string `json:"videoTitle"`
 	Genres 			string `json:"genres"`
 	Duration    int    `json:"duration"`// in seconds
+	SeriesID    string `json:"seriesId,omitempty"`
+	Season      int    `json:"season,omitempty"`
+	Episode     int    `json:"episode,omitempty"`
 }
 
 type AdEvent struct {
 	PageViewEvent
 	AdID        string `json:"adId"`
 	AdType      string `json:"adType"`
+	CampaignID  string `json:"campaignId,omitempty"`
 	Duration    int 	 `json:"duration"`// in seconds
 }
 
+type AdRequestEvent struct {
+	PageViewEvent
+	RequestID    string  `json:"requestId"`
+	Filled       bool    `json:"filled"`
+	CampaignID   string  `json:"campaignId,omitempty"`
+	Bid          float64 `json:"bid,omitempty"`
+	WinPrice     float64 `json:"winPrice"`
+	Bidders      int     `json:"bidders"`
+	NoFillReason string  `json:"noFillReason,omitempty"`
+}
+
 type StatusChangeEvent struct {
 	PageViewEvent
-	OldStatus   string
-	NewStatus   string
+	OldStatus   string `json:"oldStatus"`
+	NewStatus   string `json:"newStatus"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// ContentUnavailableEvent is the error page shown when the title a user is watching is
+// pulled: status 451 when it is no longer licensed in their region, 404 when it is gone.
+type ContentUnavailableEvent struct {
+	PageViewEvent
+	VideoID     string `json:"videoId"`
+	VideoTitle  string `json:"videoTitle"`
+}
+
+// PlaybackEvent reports what a viewer does while watching a title: start, heartbeat, pause,
+// resume, seek, stop when they give up on it or complete when they reach the end.
+type PlaybackEvent struct {
+	PageViewEvent
+	VideoID         string  `json:"videoId"`
+	EventType       string  `json:"eventType"`
+	Position        int     `json:"position"` // seconds into the title
+	PercentComplete float64 `json:"percentComplete"`
+	SeekFrom        *int    `json:"seekFrom,omitempty"`
+	PauseSeconds    int     `json:"pauseSeconds,omitempty"`
+}
+
+// LiveStreamEvent reports a viewer joining, staying tuned in to or leaving a live event.
+type LiveStreamEvent struct {
+	PageViewEvent
+	StreamID       string `json:"streamId"`
+	StreamTitle    string `json:"streamTitle"`
+	Genre          string `json:"genre,omitempty"`
+	EventType      string `json:"eventType"`
+	LiveOffset     int    `json:"liveOffset"`     // seconds since the stream started, negative before the start
+	WatchedSeconds int    `json:"watchedSeconds"` // seconds since the viewer joined
 }
 
 // DeviceTypes defines possible types of devices for the simulation.
@@ -159,7 +224,7 @@ func NextUserID() int64 {
 }
 
 // NewUser creates a new User instance.
-func NewUser(alpha float64, beta float64, startTime time.Time, auth, level string, cfg *config.Config, rng *rand.Rand, genres map[string]int) *User {
+func NewUser(alpha float64, beta float64, startTime time.Time, auth, level string, subscription SubscriptionType, region config.Region, cfg *config.Config, rng *rand.Rand, genres map[string]float64, platform *Platform) *User {
 	// Randomly select device type and operating system for the user
 	deviceType := DeviceTypes[rand.Intn(len(DeviceTypes))]
 	operatingSystem := OperatingSystems[rand.Intn(len(OperatingSystems))]
@@ -173,10 +238,19 @@ func NewUser(alpha float64, beta float64, startTime time.Time, auth, level strin
 		Rng: rng,  
 	}
 	nextEventTime := tempSession.PickFirstTimeStamp(startTime, beta)
-	stateMap := InitializeStatesWithAuthLevel(cfg, rng)
-	session := NewSession(nextEventTime, alpha, beta, stateMap, auth, level, rng, cfg)
-
-	return &User{
+	session := NewSession(nextEventTime, alpha, beta, platform.StateMap, auth, level, subscription, rng, cfg, platform)
+	adHistory := NewAdHistory()
+	session.AdHistory = adHistory
+	session.DeviceType = deviceType
+	session.Region = region.Name
+	session.GenrePreferences = genres
+	seriesProgress := make(SeriesProgress)
+	session.SeriesProgress = seriesProgress
+	liveDecisions := make(map[string]bool)
+	session.LiveDecisions = liveDecisions
+	session.startContent()
+
+	user := &User{
 		ID:               NextUserID(),
 		Alpha:            alpha,
 		Beta:             beta,
@@ -196,21 +270,46 @@ func NewUser(alpha float64, beta float64, startTime time.Time, auth, level strin
 			"version": "1.0",
 		},
 		GenrePreferences: genres,
+		SeriesProgress:   seriesProgress,
+		LiveDecisions:    liveDecisions,
+		SubscriptionType: subscription,
+		Region:           region,
+		AdHistory:        adHistory,
 		Rng: 					 		rng,
 		Config:          	cfg,
+		Platform:         platform,
 	}
+	user.startBillingCycle(nextEventTime)
+	return user
 }
 
 // nextEvent with optional probability of attrition
 func (u *User) NextEvent(prAttrition ...float64) {
+	previousState := u.CurrentSession.CurrentState
+	u.lastStatusChange = nil
 	u.CurrentSession.IncrementEvent()
+	u.queueAuthLevelChanges()
+	u.queueAdRequests()
+	u.queueRemovals()
+	u.queuePlayback()
+	u.queueLive()
+	for _, movie := range u.CurrentSession.TakeCompletedWatches() {
+		u.WatchVideo(movie)
+	}
+	enteredPage := ""
+	if !u.CurrentSession.Finished && u.CurrentSession.CurrentState != previousState {
+		enteredPage = u.CurrentSession.CurrentState.Page
+	}
+	u.advanceSubscription(enteredPage)
+	u.advanceBilling(u.CurrentSession.NextEventTime)
 	if u.CurrentSession.IsDone() {
 		var probability float64
 		if len(prAttrition) > 0 {
 			probability = prAttrition[0]
 		}
 
-		if u.Rng.Float64() < probability || u.CurrentSession.CurrentState.AuthStatus == "" {
+		session := u.CurrentSession
+		if u.Rng.Float64() < probability || session.CurrentState.AuthStatus == "" || !session.StateMap.CanStart(session.Auth, session.Level) {
 			u.CurrentSession.NextEventTime = time.Time{} // Assign zero value of time.Time
 			fmt.Println("Session marked as potentially churned")
 		} else {
@@ -227,16 +326,133 @@ func serialize(data interface{}) ([]byte, error) {
 }
 
 
-// Serialize serializes the user's current state to a JSON string for logging.
-func (u *User) Serialize(rng *rand.Rand, config *config.Config) (EventMessage, error) {
-	currentState := u.CurrentSession.CurrentState  
+// queueAdRequests turns the session's ad decisions into events for the ad_requests topic.
+func (u *User) queueAdRequests() {
+	for _, decision := range u.CurrentSession.TakeAdDecisions() {
+		baseEvent := u.pageViewEvent()
+		baseEvent.Timestamp = decision.Time.Unix()
+		u.queueEvent("ad_requests", AdRequestEvent{
+			PageViewEvent: baseEvent,
+			RequestID:     decision.RequestID,
+			Filled:        decision.Filled,
+			CampaignID:    decision.Campaign,
+			Bid:           decision.Bid,
+			WinPrice:      decision.WinPrice,
+			Bidders:       decision.Bidders,
+			NoFillReason:  decision.NoFillReason,
+		})
+	}
+}
+
+// queueAuthLevelChanges reports the upgrade and downgrade transitions the session took: an
+// auth event when the user's auth changed and, when their level changed without a change of
+// subscription already moving them there, the upgrade or downgrade to the nearest tier of
+// the new level.
+func (u *User) queueAuthLevelChanges() {
+	for _, change := range u.CurrentSession.TakeAuthLevelChanges() {
+		if change.NewAuth != change.OldAuth {
+			baseEvent := u.pageViewEvent()
+			baseEvent.Timestamp = change.Time.Unix()
+			baseEvent.Auth = change.NewAuth
+			u.queueEvent("auth_events", AuthEvent{
+				PageViewEvent: baseEvent,
+				Success:       true,
+				PreviousAuth:  change.OldAuth,
+			})
+		}
+		if change.NewLevel != change.OldLevel && levelForTier(u.Config, u.SubscriptionType) != change.NewLevel {
+			if change.Type == "upgrade" {
+				u.queueStatusChange(u.upgrade(change.NewLevel, change.Time))
+			} else {
+				u.queueStatusChange(u.downgrade(change.NewLevel, change.Time))
+			}
+		}
+	}
+}
+
+// queueRemovals reports the titles pulled while the user watched them as error pages.
+func (u *User) queueRemovals() {
+	for _, removal := range u.CurrentSession.TakeRemovals() {
+		baseEvent := u.pageViewEvent()
+		baseEvent.Timestamp = removal.Time.Unix()
+		baseEvent.Page = "Error"
+		baseEvent.Method = "GET"
+		baseEvent.Status = removal.Status
+		u.queueEvent("page_views_events", ContentUnavailableEvent{
+			PageViewEvent: baseEvent,
+			VideoID:       removal.Item.ID,
+			VideoTitle:    removal.Item.Title,
+		})
+	}
+}
+
+// queuePlayback reports what the user did in the player since the last event.
+func (u *User) queuePlayback() {
+	for _, report := range u.CurrentSession.TakePlaybackActions() {
+		action := report.Action
+		baseEvent := u.pageViewEvent()
+		baseEvent.Timestamp = action.Time.Unix()
+		event := PlaybackEvent{
+			PageViewEvent:   baseEvent,
+			VideoID:         report.Playback.Item.ID,
+			EventType:       action.Type,
+			Position:        int(action.Position / time.Second),
+			PercentComplete: report.Playback.PercentComplete(action.Position),
+			PauseSeconds:    int(action.Paused / time.Second),
+		}
+		if action.Type == "seek" {
+			from := int(action.From / time.Second)
+			event.SeekFrom = &from
+		}
+		u.queueEvent("playback_events", event)
+	}
+}
+
+// queueLive reports the user tuning in to live events.
+func (u *User) queueLive() {
+	for _, action := range u.CurrentSession.TakeLiveActions() {
+		baseEvent := u.pageViewEvent()
+		baseEvent.Timestamp = action.Time.Unix()
+		u.queueEvent("live_events", LiveStreamEvent{
+			PageViewEvent:  baseEvent,
+			StreamID:       action.Stream.ID,
+			StreamTitle:    action.Stream.Title,
+			Genre:          action.Stream.Genre,
+			EventType:      action.Type,
+			LiveOffset:     int(action.Time.Sub(action.Stream.Start) / time.Second),
+			WatchedSeconds: int(action.Time.Sub(action.Joined) / time.Second),
+		})
+	}
+}
+
+// queueEvent serializes an event produced outside the page view flow so it can be
+// written out with FlushEvents.
+func (u *User) queueEvent(topic string, event interface{}) {
+	data, err := serialize(event)
+	if err != nil {
+		log.Printf("Error serializing %s event: %v", topic, err)
+		return
+	}
+	u.pendingEvents = append(u.pendingEvents, EventMessage{Topic: topic, Message: data})
+}
 
-	baseEvent := PageViewEvent{
-		Timestamp:      time.Now().Unix(),
+// FlushEvents returns the events queued since the last call.
+func (u *User) FlushEvents() []EventMessage {
+	events := u.pendingEvents
+	u.pendingEvents = nil
+	return events
+}
+
+// pageViewEvent builds the fields shared by every event from the user and current session.
+func (u *User) pageViewEvent() PageViewEvent {
+	currentState := u.CurrentSession.CurrentState
+	return PageViewEvent{
+		Timestamp:      u.CurrentSession.NextEventTime.Unix(),
 		SessionID:      u.CurrentSession.ID,
-		SessionDuration: time.Since(u.CurrentSession.StartTime).Minutes(),
+		SessionDuration: u.CurrentSession.NextEventTime.Sub(u.CurrentSession.StartTime).Minutes(),
 		Page:           currentState.Page,
 		Auth:           currentState.AuthStatus,
+		Level:          currentState.UserLevel,
 		Method:         currentState.Method,
 		Status:         currentState.StatusCode,
 		UserID:         u.ID,
@@ -247,7 +463,14 @@ func (u *User) Serialize(rng *rand.Rand, config *config.Config) (EventMessage, e
 		FirstName: 			u.Properties["firstName"].(string),
 		LastName: 			u.Properties["lastName"].(string),
 		DateOfBirth: 		u.Properties["dob"].(string),	
+		Region:         u.Region.Name,
 	}
+}
+
+// Serialize serializes the user's current state to a JSON string for logging.
+func (u *User) Serialize(rng *rand.Rand, config *config.Config) (EventMessage, error) {
+	currentState := u.CurrentSession.CurrentState  
+	baseEvent := u.pageViewEvent()
 
 	var topic = "page_views_events"
 	var event interface{}
@@ -260,41 +483,74 @@ func (u *User) Serialize(rng *rand.Rand, config *config.Config) (EventMessage, e
 			topic = "auth_events"
 
 		case "NextVideo":
-			event = WatchEvent{
+			topic = "watch_events"
+			movie := u.CurrentSession.CurrentMovie
+			if movie == nil {
+				// No movie catalog is loaded.
+				event = baseEvent
+				break
+			}
+			watch := WatchEvent{
 				PageViewEvent: baseEvent,
-				VideoID:    u.CurrentSession.CurrentMovie.MovieID,
-				VideoTitle: u.CurrentSession.CurrentMovie.Name,
-				Duration:   int(u.CurrentSession.CurrentMovie.RuntimeMinutes.Minutes()),
+				VideoID:    movie.ID,
+				VideoTitle: movie.Title,
+				Genres:     strings.Join(movie.Genres, ", "),
+				Duration:   int(movie.Runtime.Minutes()),
 			}
-			topic = "watch_events"
+			if episode := u.CurrentSession.CurrentEpisode; episode != nil {
+				watch.SeriesID = episode.SeriesID
+				watch.Season = episode.Season
+				watch.Episode = episode.Number
+			}
+			event = watch
 
 		case "NextSong":
+			topic = "listen_events"
+			song := u.CurrentSession.CurrentSong
+			if song == nil {
+				// No audio catalog is loaded.
+				event = baseEvent
+				break
+			}
 			event = ListenEvent{
 				PageViewEvent: baseEvent,
-				SongID:        "someSongID",
-				AudioTitle:    "Some Song Title",
-				ArtistName:    "Some Artist",
-				Duration:      180, // example duration in seconds
+				SongID:        song.SongID,
+				AudioTitle:    song.Title,
+				ArtistName:    song.Artist,
+				AlbumTitle:    song.Album,
+				Genre:         song.Genre,
+				Duration:      int(song.Duration.Seconds()),
 			}
-			topic = "listen_events"
 		case "AdStart", "AdImpression", "AdEnd":
-			if u.CurrentSession.CurrentAd == nil {
-				u.CurrentSession.handleAdEvent()
-			} 
+			topic = "ad_events"
+			ad := u.CurrentSession.CurrentAd
+			if ad == nil {
+				// The ad already finished or the session opened on an ad page.
+				event = baseEvent
+				break
+			}
 			event = AdEvent{
 				PageViewEvent: baseEvent,
-				AdID:       u.CurrentSession.CurrentAd.ID,
-				AdType:     u.CurrentSession.CurrentAd.Type,
-				Duration:   int(u.CurrentSession.CurrentAd.Duration),
+				AdID:       ad.ID,
+				AdType:     ad.Type,
+				CampaignID: ad.Campaign,
+				Duration:   int(ad.Duration),
 			}
-			topic = "ad_events"
 
-		case "Submit Upgrade", "Submit Downgrade", "Cancel Subscription":
+		case "Submit Upgrade", "Submit Downgrade", "Cancel Subscription", "Cancellation Confirmation":
+			change := u.lastStatusChange
+			if change == nil {
+				// The page did not change the subscription, e.g. a downgrade on the lowest tier.
+				event = baseEvent
+				break
+			}
 			event = StatusChangeEvent{
 				PageViewEvent: baseEvent,
-				OldStatus:  string(u.SubscriptionType),
-				NewStatus:  string(u.SubscriptionType),
+				OldStatus:  string(change.Old),
+				NewStatus:  string(change.New),
+				Reason:     change.Reason,
 			}
+			topic = "status_change_events"
 		default:
 			event = baseEvent
 	}
@@ -307,21 +563,37 @@ func (u *User) Serialize(rng *rand.Rand, config *config.Config) (EventMessage, e
 	return EventMessage{Topic: topic, Message: data}, nil
 }
 
-// AdjustGenrePreferences updates the user's preferences based on the genres of the recently watched video.
-func (u *User) AdjustGenrePreferences(watchedVideo *config.Video) {
-	for _, genre := range watchedVideo.Genres {
-			if _, exists := u.GenrePreferences[genre]; exists {
-					u.GenrePreferences[genre] += 1 // Increment preference weight for each watched genre
-			} else {
-					u.GenrePreferences[genre] = 1 // Set initial preference if genre is new to the user
-			}
+// AdjustGenrePreferences updates the user's preferences after they watched a movie to the end.
+// Every preference decays a little, so interests the user no longer follows fade, and each
+// genre of the movie gains the configured learning rate times the user's average preference.
+// Genres the user had no preference for are picked up the same way.
+func (u *User) AdjustGenrePreferences(watched *catalog.Item) {
+	taste := u.Config.Taste
+	if u.GenrePreferences == nil {
+		u.GenrePreferences = make(map[string]float64)
+	}
+	average := 1.0
+	if len(u.GenrePreferences) > 0 {
+		total := 0.0
+		for _, preference := range u.GenrePreferences {
+			total += preference
+		}
+		average = total / float64(len(u.GenrePreferences))
+	}
+	if taste.Decay > 0 && taste.Decay < 1 {
+		for genre := range u.GenrePreferences {
+			u.GenrePreferences[genre] *= taste.Decay
+		}
+	}
+	for _, genre := range watched.Genres {
+		u.GenrePreferences[genre] += taste.LearningRate * average
 	}
 }
 
-// Update preferences after a video is watched
-func (u *User) WatchVideo(video *config.Video) {
-	u.AdjustGenrePreferences(video)
-	// Additional logic for handling the watch event
+// WatchVideo updates the user's preferences after a movie is watched to the end.
+func (u *User) WatchVideo(movie *catalog.Item) {
+	u.AdjustGenrePreferences(movie)
+	u.CurrentSession.GenrePreferences = u.GenrePreferences
 }
 
 func (u *User) DecidesToContinueWatching() bool {
@@ -330,23 +602,24 @@ func (u *User) DecidesToContinueWatching() bool {
 }
 
 
-// Implement weightedRandomSelect assuming it returns *config.Video
-func weightedRandomSelect(videos []*config.Video, weights []int) *config.Video {
-	// Your weighted selection logic here
-	totalWeight := 0
-	for _, weight := range weights {
-			totalWeight += weight
+// weightedRandomSelect picks one of items with probability proportional to its weight.
+// Items with a non-positive weight are never picked; ok is false when nothing can be picked.
+func weightedRandomSelect[T any](rng *rand.Rand, items []T, weights []float64) (item T, ok bool) {
+	cumulative := make([]float64, len(items))
+	total := 0.0
+	for i := range items {
+		if i < len(weights) && weights[i] > 0 {
+			total += weights[i]
+		}
+		cumulative[i] = total
 	}
-
-	r := rand.Intn(totalWeight)
-	for i, weight := range weights {
-			r -= weight
-			if r <= 0 {
-					return videos[i]
-			}
+	if total <= 0 {
+		return item, false
 	}
-
-	return nil // In case something goes wrong
+	r := rng.Float64() * total
+	i := sort.Search(len(cumulative), func(i int) bool { return cumulative[i] > r })
+	if i == len(items) {
+		i = len(items) - 1
+	}
+	return items[i], true
 }
-
-
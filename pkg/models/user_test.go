@@ -0,0 +1,110 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
+	"github.com/chrisdamba/simstreamdata/pkg/config"
+)
+
+const selectionDraws = 100000
+
+func TestWeightedRandomSelectDistribution(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	items := []string{"a", "b", "c", "never"}
+	weights := []float64{1, 2, 7, 0}
+
+	counts := make(map[string]int)
+	for i := 0; i < selectionDraws; i++ {
+		item, ok := weightedRandomSelect(rng, items, weights)
+		if !ok {
+			t.Fatal("weightedRandomSelect found nothing to pick")
+		}
+		counts[item]++
+	}
+
+	if counts["never"] != 0 {
+		t.Errorf("picked a zero-weight item %d times", counts["never"])
+	}
+	for i, item := range items[:3] {
+		want := weights[i] / 10
+		if got := float64(counts[item]) / selectionDraws; math.Abs(got-want) > 0.01 {
+			t.Errorf("item %q picked %.3f of the time, want %.3f", item, got, want)
+		}
+	}
+}
+
+func TestWeightedRandomSelectWithoutWeight(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	if _, ok := weightedRandomSelect(rng, []string{"a", "b"}, []float64{0, 0}); ok {
+		t.Error("picked an item although every weight is zero")
+	}
+	if _, ok := weightedRandomSelect(rng, []string{}, nil); ok {
+		t.Error("picked an item from an empty list")
+	}
+}
+
+func TestNextMovieFollowsPreferencesAndPopularity(t *testing.T) {
+	hit := &catalog.Item{ID: "hit", Genres: []string{"Drama"}, Votes: 500000, Rating: 8.5}
+	obscure := &catalog.Item{ID: "obscure", Genres: []string{"Drama"}}
+	comedy := &catalog.Item{ID: "comedy", Genres: []string{"Comedy"}, Votes: 1000, Rating: 6}
+	session := &Session{
+		Rng:              rand.New(rand.NewSource(1)),
+		Config:           &config.Config{},
+		Platform:         &Platform{Catalog: catalog.NewMemory([]*catalog.Item{hit, obscure, comedy})},
+		GenrePreferences: map[string]float64{"Drama": 3, "Comedy": 1},
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < selectionDraws; i++ {
+		counts[session.nextMovie().ID]++
+	}
+
+	drama := float64(counts["hit"]+counts["obscure"]) / selectionDraws
+	if math.Abs(drama-0.75) > 0.01 {
+		t.Errorf("Drama picked %.3f of the time, want 0.750", drama)
+	}
+	wantHit := hit.Popularity() / (hit.Popularity() + obscure.Popularity())
+	if got := float64(counts["hit"]) / float64(counts["hit"]+counts["obscure"]); math.Abs(got-wantHit) > 0.01 {
+		t.Errorf("popular Drama picked %.3f of Drama picks, want %.3f", got, wantHit)
+	}
+}
+
+func TestNextMovieRespectsTierCatalog(t *testing.T) {
+	session := &Session{
+		Rng: rand.New(rand.NewSource(1)),
+		Config: &config.Config{
+			SubscriptionTiers: []config.SubscriptionTier{{Name: "free", Genres: []string{"Comedy"}}},
+		},
+		Platform: &Platform{Catalog: catalog.NewMemory([]*catalog.Item{
+			{ID: "drama", Genres: []string{"Drama"}},
+			{ID: "comedy", Genres: []string{"Comedy"}},
+		})},
+		SubscriptionTier: Free,
+		GenrePreferences: map[string]float64{"Drama": 100, "Comedy": 1},
+	}
+
+	for i := 0; i < 1000; i++ {
+		if movie := session.nextMovie(); movie.ID != "comedy" {
+			t.Fatalf("free tier was given %q outside its catalog", movie.ID)
+		}
+	}
+}
+
+func TestAdjustGenrePreferencesDecaysAndLearns(t *testing.T) {
+	user := &User{
+		Config:           &config.Config{Taste: config.TasteConfig{Decay: 0.5, LearningRate: 0.25}},
+		GenrePreferences: map[string]float64{"Drama": 6, "Comedy": 2},
+	}
+	user.AdjustGenrePreferences(&catalog.Item{Genres: []string{"Comedy", "Horror"}})
+
+	// the average preference before the watch is 4, so watched genres gain 1
+	want := map[string]float64{"Drama": 3, "Comedy": 2, "Horror": 1}
+	for genre, w := range want {
+		if got := user.GenrePreferences[genre]; math.Abs(got-w) > 1e-9 {
+			t.Errorf("preference for %s is %.3f, want %.3f", genre, got, w)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/chrisdamba/simstreamdata/pkg/catalog"
 	"github.com/chrisdamba/simstreamdata/pkg/config"
 	"github.com/chrisdamba/simstreamdata/pkg/models"
 )
@@ -30,6 +31,7 @@ type Simulator struct {
     StateMachine    *models.StateMachine
     Users           []*models.User
     UserQueue       *models.UserQueue
+    Platform        *models.Platform
 }
 
 type FileOutput struct {
@@ -47,13 +49,20 @@ func NewFileOutput(basePath string) *FileOutput {
 
 type ConsoleOutput struct{}
 
-func NewSimulator(cfg *config.Config) *Simulator {
+// NewSimulator sets up a simulation of the configured platform, returning an error when the
+// configuration cannot be simulated.
+func NewSimulator(cfg *config.Config, videos catalog.Catalog) (*Simulator, error) {
+    platform, err := models.NewPlatform(cfg, videos)
+    if err != nil {
+        return nil, fmt.Errorf("invalid state machine: %w", err)
+    }
     return &Simulator{
         Config: cfg,
         Rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
         Users:  []*models.User{},
         UserQueue: models.NewUserQueue(),
-    }
+        Platform: platform,
+    }, nil
 }
 
 func (f *FileOutput) WriteMessage(topic string, msg []byte) error {
@@ -117,11 +126,18 @@ func randomLogNormal(mean, stddev float64) float64 {
 
 func (sim *Simulator) initializeUsers() {
     for i := 0; i < sim.Config.NUsers; i++ {
-        // Generate random preferences based on weighted selections
-        initialLevel := sim.weightedRandomInitialLevel()
-
         // Determine the authorization level and subscription type with weights
         authLevel := sim.weightedRandomAuthLevel()
+        subscription := sim.weightedRandomSubscriptionType()
+        if authLevel == "Guest" {
+            subscription = models.Free // guests have not registered, so they cannot hold a paid plan
+        }
+
+        // Generate random preferences based on weighted selections; a configured tier fixes the level
+        initialLevel := sim.weightedRandomInitialLevel()
+        if tier, ok := sim.Config.Tier(string(subscription)); ok && tier.Level != "" {
+            initialLevel = tier.Level
+        }
 
         // Generate random genre preferences
         genrePreferences := sim.generateRandomGenrePreferences()
@@ -134,9 +150,12 @@ func (sim *Simulator) initializeUsers() {
             startTime,
             authLevel,
             initialLevel,
+            subscription,
+            sim.weightedRandomRegion(),
             sim.Config,
             sim.Rng,
             genrePreferences,
+            sim.Platform,
         )
 
         sim.UserQueue.Enqueue(user)
@@ -153,21 +172,42 @@ func (sim *Simulator) weightedRandomInitialLevel() string {
 }
 
 func (sim *Simulator) weightedRandomSubscriptionType() models.SubscriptionType {
+    if len(sim.Config.SubscriptionChances) == 0 {
+        return models.Free
+    }
     chosen := sim.selectRandomPreference(convertToPreferences(sim.Config.SubscriptionChances))
-    return models.SubscriptionType(chosen.Name)
+    return models.SubscriptionType(strings.ToLower(chosen.Name))
 }
 
 // generateRandomGenrePreferences generates a map of genres with randomized weights based on configured preferences
-func (sim *Simulator) generateRandomGenrePreferences() map[string]int {
-    genreMap := make(map[string]int)
+func (sim *Simulator) generateRandomGenrePreferences() map[string]float64 {
+    genreMap := make(map[string]float64)
     for _, genre := range sim.Config.Genres {
         // Randomize genre weight: here we simulate user preference strength by multiplying the base weight by a random factor
         randomFactor := rand.Intn(10) + 1  // Random factor between 1 and 10
-        genreMap[genre.Name] = genre.Weight * randomFactor
+        genreMap[genre.Name] = float64(genre.Weight * randomFactor)
     }
     return genreMap
 }
 
+// weightedRandomRegion picks the region a new user lives in, by configured weight.
+func (sim *Simulator) weightedRandomRegion() config.Region {
+    if len(sim.Config.Regions) == 0 {
+        return config.Region{}
+    }
+    preferences := make([]config.Preference, len(sim.Config.Regions))
+    for i, region := range sim.Config.Regions {
+        preferences[i] = config.Preference{Name: region.Name, Weight: region.Weight}
+    }
+    chosen := sim.selectRandomPreference(preferences)
+    for _, region := range sim.Config.Regions {
+        if region.Name == chosen.Name {
+            return region
+        }
+    }
+    return sim.Config.Regions[0]
+}
+
 func convertToPreferences(subscriptionChances []config.SubscriptionChance) []config.Preference {
     preferences := make([]config.Preference, len(subscriptionChances))
     for i, chance := range subscriptionChances {
@@ -310,6 +350,11 @@ func (sim *Simulator) RunSimulation() {
         // Process the next event in the current session
         user.NextEvent(prAttrition)
         eventsCount++
+        for _, msg := range user.FlushEvents() {
+            if err := output.WriteMessage(msg.Topic, msg.Message); err != nil {
+                log.Printf("Failed to write message: %v", err)
+            }
+        }
 
         
     }